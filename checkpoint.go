@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	stateDiscovered = "discovered"
+	statePulled     = "pulled"
+	statePushed     = "pushed"
+	stateVerified   = "verified"
+	stateFailed     = "failed"
+
+	defaultCheckpointFlushInterval = 2 * time.Second
+)
+
+type checkpointEntry struct {
+	Repository string    `json:"repository"`
+	Reference  string    `json:"reference"`
+	Status     string    `json:"status"`
+	Digest     string    `json:"digest,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type Checkpoint struct {
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	path    string
+	dirty   bool
+	stopch  chan struct{}
+	donech  chan struct{}
+	Images  map[string]checkpointEntry `json:"images"`
+}
+
+func loadCheckpoint(path string, resume bool) (*Checkpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	c := &Checkpoint{
+		path:   path,
+		Images: make(map[string]checkpointEntry),
+	}
+
+	if !resume {
+		return c, c.save()
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	if c.Images == nil {
+		c.Images = make(map[string]checkpointEntry)
+	}
+	return c, nil
+}
+
+func (c *Checkpoint) withFlushInterval(interval time.Duration) *Checkpoint {
+	if c == nil {
+		return nil
+	}
+
+	c.stopch = make(chan struct{})
+	c.donech = make(chan struct{})
+	go c.flushEvery(interval)
+	return c
+}
+
+func (c *Checkpoint) flushEvery(interval time.Duration) {
+	defer close(c.donech)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.flush(); err != nil {
+				slog.Error("checkpoint", "path", c.path, "error", err)
+			}
+		case <-c.stopch:
+			return
+		}
+	}
+}
+
+func checkpointKey(repository, reference string) string {
+	return repository + "|" + reference
+}
+
+func (c *Checkpoint) completed(repository, reference string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.Images[checkpointKey(repository, reference)]
+	return entry.Status == statePushed || entry.Status == stateVerified
+}
+
+func (c *Checkpoint) digest(repository, reference string) string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Images[checkpointKey(repository, reference)].Digest
+}
+
+func (c *Checkpoint) set(repository, reference, status string, cause error) {
+	entry := checkpointEntry{
+		Repository: repository,
+		Reference:  reference,
+		Status:     status,
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+	c.store(entry)
+}
+
+func (c *Checkpoint) pushed(repository, reference, status, digest string) {
+	c.store(checkpointEntry{
+		Repository: repository,
+		Reference:  reference,
+		Status:     status,
+		Digest:     digest,
+	})
+}
+
+func (c *Checkpoint) store(entry checkpointEntry) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.UpdatedAt = time.Now().UTC()
+	c.Images[checkpointKey(entry.Repository, entry.Reference)] = entry
+	c.dirty = true
+}
+
+func (c *Checkpoint) flush() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := c.write(b); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (c *Checkpoint) close() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.stopch != nil {
+		close(c.stopch)
+		<-c.donech
+		c.stopch = nil
+	}
+	return c.flush()
+}
+
+func (c *Checkpoint) save() error {
+	c.mu.Lock()
+	b, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.write(b)
+}
+
+func (c *Checkpoint) write(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	checkpoint, err := loadCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint.set("repo/test/app1", "1.0", statePulled, nil)
+	checkpoint.set("repo/test/app1", "1.1", stateVerified, nil)
+	checkpoint.set("repo/test/app1", "1.2", stateFailed, errors.New("denied"))
+	checkpoint.set("repo/test/app2", "2.0", statePushed, nil)
+	checkpoint.pushed("repo/test/app2", "2.1", stateVerified, "sha256:abc")
+
+	assert.False(t, checkpoint.completed("repo/test/app1", "1.0"))
+	assert.True(t, checkpoint.completed("repo/test/app1", "1.1"))
+	assert.NoError(t, checkpoint.close())
+
+	resumed, err := loadCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, resumed.completed("repo/test/app1", "1.0"))
+	assert.True(t, resumed.completed("repo/test/app1", "1.1"))
+	assert.False(t, resumed.completed("repo/test/app1", "1.2"))
+	assert.True(t, resumed.completed("repo/test/app2", "2.0"))
+	assert.Equal(t, "denied", resumed.Images[checkpointKey("repo/test/app1", "1.2")].Error)
+	assert.Equal(t, "sha256:abc", resumed.digest("repo/test/app2", "2.1"))
+
+	fresh, err := loadCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, fresh.completed("repo/test/app2", "2.0"), "expected a run without resume to start over")
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, entries, 1, "expected no temporary files left behind")
+}
+
+func TestCheckpointConcurrentUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	checkpoint, err := loadCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			checkpoint.set("repo/test/app1", fmt.Sprintf("1.%d", i), statePushed, nil)
+		}(i)
+	}
+	wg.Wait()
+	assert.NoError(t, checkpoint.close())
+
+	resumed, err := loadCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, resumed.Images, 20)
+}
+
+func TestCheckpointDisabled(t *testing.T) {
+	checkpoint, err := loadCheckpoint("", true)
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	checkpoint.set("repo/test/app1", "1.0", statePushed, nil)
+	assert.False(t, checkpoint.completed("repo/test/app1", "1.0"))
+	assert.NoError(t, checkpoint.close())
+}
+
+func TestCheckpointResumeWithoutFile(t *testing.T) {
+	checkpoint, err := loadCheckpoint(filepath.Join(t.TempDir(), "missing.json"), true)
+	assert.NoError(t, err)
+	assert.Empty(t, checkpoint.Images)
+}
+
+func TestCheckpointFlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	checkpoint, err := loadCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint = checkpoint.withFlushInterval(10 * time.Millisecond)
+
+	checkpoint.set("repo/test/app1", "1.0", statePushed, nil)
+	assert.Eventually(t, func() bool {
+		resumed, err := loadCheckpoint(path, true)
+		return err == nil && resumed.completed("repo/test/app1", "1.0")
+	}, time.Second, 10*time.Millisecond, "expected the ticker to flush pending updates")
+
+	checkpoint.set("repo/test/app1", "1.1", stateVerified, nil)
+	assert.NoError(t, checkpoint.close())
+
+	resumed, err := loadCheckpoint(path, true)
+	assert.NoError(t, err)
+	assert.True(t, resumed.completed("repo/test/app1", "1.1"), "expected close to flush the last updates")
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
@@ -13,6 +16,15 @@ type CloudConfig struct {
 	cfg     aws.Config
 	region  string
 	profile string
+	role    assumeRole
+	retryer aws.Retryer
+}
+
+type assumeRole struct {
+	arn         string
+	externalID  string
+	sessionName string
+	mfaSerial   string
 }
 
 type Option func(*CloudConfig)
@@ -29,7 +41,24 @@ func withProfile(profile string) Option {
 	}
 }
 
-func mustInitConfig(opts ...Option) *CloudConfig {
+func withAssumeRole(arn, externalID, sessionName, mfaSerial string) Option {
+	return func(cc *CloudConfig) {
+		cc.role = assumeRole{
+			arn:         arn,
+			externalID:  externalID,
+			sessionName: sessionName,
+			mfaSerial:   mfaSerial,
+		}
+	}
+}
+
+func withRetryer(retryer aws.Retryer) Option {
+	return func(cc *CloudConfig) {
+		cc.retryer = retryer
+	}
+}
+
+func initConfig(opts ...Option) (*CloudConfig, error) {
 	defaultOpts := &CloudConfig{
 		cfg:     aws.Config{},
 		region:  "",
@@ -40,17 +69,78 @@ func mustInitConfig(opts ...Option) *CloudConfig {
 		opt(defaultOpts)
 	}
 
-	cfg, err := config.LoadDefaultConfig(
-		context.Background(),
+	loadOpts := []func(*config.LoadOptions) error{
 		config.WithSharedConfigProfile(defaultOpts.profile),
 		config.WithRegion(defaultOpts.region),
-	)
+	}
+	if defaultOpts.retryer != nil {
+		loadOpts = append(loadOpts, config.WithRetryer(func() aws.Retryer {
+			return defaultOpts.retryer
+		}))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), loadOpts...)
 	if err != nil {
-		panic(err)
+		return nil, configErr(err)
 	}
 
 	defaultOpts.cfg = cfg
-	return defaultOpts
+	if defaultOpts.role.arn != "" {
+		defaultOpts.assume()
+	}
+
+	return defaultOpts, nil
+}
+
+func (c *CloudConfig) assume() {
+	svc := c.stablishClientWith(
+		stsService(c.cfg),
+	)
+
+	provider := stscreds.NewAssumeRoleProvider(svc.sts, c.role.arn, func(o *stscreds.AssumeRoleOptions) {
+		if c.role.externalID != "" {
+			o.ExternalID = aws.String(c.role.externalID)
+		}
+		if c.role.sessionName != "" {
+			o.RoleSessionName = c.role.sessionName
+		}
+		if c.role.mfaSerial != "" {
+			o.SerialNumber = aws.String(c.role.mfaSerial)
+			o.TokenProvider = stscreds.StdinTokenProvider
+		}
+	})
+
+	c.cfg.Credentials = aws.NewCredentialsCache(provider)
+}
+
+type registryIdentity struct {
+	account string
+	arn     string
+	region  string
+}
+
+func (r registryIdentity) host() string {
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", r.account, r.region)
+}
+
+func (c *CloudConfig) callerIdentity(side string) (registryIdentity, error) {
+	svc := c.stablishClientWith(
+		stsService(c.cfg),
+	)
+
+	identity, err := svc.sts.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return registryIdentity{}, authErr(fmt.Errorf("%s caller identity: %w", side, err))
+	}
+
+	registry := registryIdentity{
+		account: aws.ToString(identity.Account),
+		arn:     aws.ToString(identity.Arn),
+		region:  c.cfg.Region,
+	}
+
+	slog.Info("callerIdentity", "side", side, "account", registry.account, "arn", registry.arn, "region", registry.region)
+	return registry, nil
 }
 
 func (c *CloudConfig) stablishClientWith(opts ...ResourceOpt) *ResoureceConfig {
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssumeRole(t *testing.T) {
+	var assumed url.Values
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.Form.Get("Action") {
+		case "AssumeRole":
+			assumed = r.Form
+			fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>ASSUMED</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+		default:
+			http.Error(w, "unsupported action", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	cc := &CloudConfig{
+		cfg: aws.Config{
+			Region:           "us-east-1",
+			BaseEndpoint:     aws.String(server.URL),
+			Credentials:      credentials.NewStaticCredentialsProvider("BASE", "secret", ""),
+			HTTPClient:       server.Client(),
+			RetryMaxAttempts: 1,
+		},
+	}
+	withAssumeRole("arn:aws:iam::222222222222:role/migrate", "external", "ecr-migrate", "")(cc)
+	cc.assume()
+
+	creds, err := cc.cfg.Credentials.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "ASSUMED", creds.AccessKeyID)
+
+	assert.Equal(t, "arn:aws:iam::222222222222:role/migrate", assumed.Get("RoleArn"))
+	assert.Equal(t, "external", assumed.Get("ExternalId"))
+	assert.Equal(t, "ecr-migrate", assumed.Get("RoleSessionName"))
+	assert.Empty(t, assumed.Get("SerialNumber"))
+}
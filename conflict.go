@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictFail      = "fail"
+	conflictRetag     = "retag"
+)
+
+func validateConflictPolicy(policy string) error {
+	switch policy {
+	case "", conflictSkip, conflictOverwrite, conflictFail, conflictRetag:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict policy %q, expected skip, overwrite, fail or retag", policy)
+}
+
+type conflictPolicy struct {
+	fallback     string
+	suffix       string
+	repositories map[string]string
+}
+
+func newConflictPolicy(fallback, suffix string, repositories map[string]string) conflictPolicy {
+	return conflictPolicy{
+		fallback:     fallback,
+		suffix:       suffix,
+		repositories: repositories,
+	}
+}
+
+func (p conflictPolicy) forRepository(repository string) string {
+	if policy, found := p.repositories[repository]; found {
+		return policy
+	}
+	if p.fallback == "" {
+		return conflictOverwrite
+	}
+	return p.fallback
+}
+
+type conflict struct {
+	repository      string
+	reference       string
+	targetReference string
+	sourceDigest    string
+	targetDigest    string
+	policy          string
+}
+
+func (p conflictPolicy) resolve(metadata *repositoryMetadata, comparison imageComparison, reference string) (conflict, bool) {
+	current, found := comparison.target[reference]
+	if !found || current.digest == comparison.source[reference].digest {
+		return conflict{}, true
+	}
+
+	c := conflict{
+		repository:      metadata.repositoryName,
+		reference:       reference,
+		targetReference: reference,
+		sourceDigest:    comparison.source[reference].digest,
+		targetDigest:    current.digest,
+		policy:          p.forRepository(metadata.repositoryName),
+	}
+
+	switch c.policy {
+	case conflictRetag:
+		c.targetReference = reference + p.suffix
+		if metadata.retags == nil {
+			metadata.retags = make(map[string]string)
+		}
+		metadata.retags[reference] = c.targetReference
+	case conflictSkip, conflictFail:
+		c.targetReference = ""
+	}
+
+	if c.policy == conflictOverwrite || c.policy == conflictRetag {
+		if metadata.conflicts == nil {
+			metadata.conflicts = make(map[string]conflict)
+		}
+		metadata.conflicts[reference] = c
+	}
+
+	slog.Warn("conflict", "repository", c.repository, "reference", c.reference, "sourceDigest", c.sourceDigest, "targetDigest", c.targetDigest, "policy", c.policy, "targetReference", c.targetReference)
+	return c, c.policy == conflictOverwrite || c.policy == conflictRetag
+}
+
+func conflictErr(conflicts []conflict) error {
+	var failed []string
+	for _, c := range conflicts {
+		if c.policy == conflictFail {
+			failed = append(failed, c.repository+":"+c.reference)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d tags already exist in the target with a different digest: %v", len(failed), failed)
+}
+
+func reportConflicts(conflicts []conflict) {
+	for _, c := range conflicts {
+		slog.Warn("conflictReport", "repository", c.repository, "reference", c.reference, "sourceDigest", c.sourceDigest, "targetDigest", c.targetDigest, "policy", c.policy, "targetReference", c.targetReference)
+	}
+	slog.Info("conflictReport", "conflicts", len(conflicts))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileConflicts(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	repositories := []string{"repo/test/skip", "repo/test/overwrite", "repo/test/retag", "repo/test/fail"}
+	for _, repository := range repositories {
+		sourceRegistry.addImage(repository, []string{"1.0"}, []byte("layer-1.0"))
+		targetRegistry.addImage(repository, []string{"1.0"}, []byte("layer-1.0-changed"))
+	}
+
+	policy := newConflictPolicy(conflictOverwrite, "-migrated", map[string]string{
+		"repo/test/skip":  conflictSkip,
+		"repo/test/retag": conflictRetag,
+		"repo/test/fail":  conflictFail,
+	})
+
+	source := sourceRegistry.client()
+	metadata := mustReconcile(t, source, targetRegistry.client(), mustWalk(t, source, repositories), policy)
+
+	assert.Empty(t, metadata.repoList[0].tags)
+	assert.Equal(t, []string{"1.0"}, metadata.repoList[1].tags)
+	assert.Equal(t, []string{"1.0"}, metadata.repoList[2].tags)
+	assert.Equal(t, "1.0-migrated", metadata.repoList[2].targetReference("1.0"))
+	assert.Equal(t, "1.0", metadata.repoList[1].targetReference("1.0"))
+	assert.Empty(t, metadata.repoList[3].tags)
+	assert.Equal(t, 2, metadata.imagesCount)
+
+	if assert.Len(t, metadata.conflicts, 4) {
+		assert.Equal(t, conflictSkip, metadata.conflicts[0].policy)
+		assert.Equal(t, "1.0-migrated", metadata.conflicts[2].targetReference)
+		assert.NotEqual(t, metadata.conflicts[0].sourceDigest, metadata.conflicts[0].targetDigest)
+	}
+
+	err := conflictErr(metadata.conflicts)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "repo/test/fail:1.0")
+	}
+}
+
+func TestConflictPolicy(t *testing.T) {
+	policy := newConflictPolicy("", "", map[string]string{"repo/test/app1": conflictSkip})
+	assert.Equal(t, conflictSkip, policy.forRepository("repo/test/app1"))
+	assert.Equal(t, conflictOverwrite, policy.forRepository("repo/test/app2"))
+
+	assert.NoError(t, validateConflictPolicy(conflictRetag))
+	assert.Error(t, validateConflictPolicy("rename"))
+	assert.NoError(t, conflictErr([]conflict{{policy: conflictSkip}}))
+}
+
+func TestConflictCompareFailure(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/fail", []string{"1.0"}, []byte("layer-1.0"))
+	targetRegistry.addImage("repo/test/fail", []string{"1.0"}, []byte("layer-1.0-changed"))
+	targetRegistry.errors["DescribeImages"] = "AccessDeniedException"
+
+	source := sourceRegistry.client()
+	_, err := source.reconcile(targetRegistry.client(), mustWalk(t, source, []string{"repo/test/fail"}), newConflictPolicy(conflictFail, "", nil), false)
+	assert.ErrorContains(t, err, "repo/test/fail", "expected an unknown comparison to stop the run instead of copying")
+	assert.Equal(t, exitAuthError, exitCode(err))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+const discoverAll = "all"
+
+func isRepositoryPattern(name string) bool {
+	return strings.ContainsAny(name, "*?")
+}
+
+func repositoryPattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func matchRepository(pattern, name string) bool {
+	if !isRepositoryPattern(pattern) {
+		return pattern == name
+	}
+	return repositoryPattern(pattern).MatchString(name)
+}
+
+func (r *Repositories) needsDiscovery() bool {
+	if r.Discover == discoverAll {
+		return true
+	}
+
+	for _, entry := range r.Entries {
+		if isRepositoryPattern(entry.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repositories) entryFor(name string) (repositoryConfig, bool) {
+	for _, entry := range r.Entries {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+
+	for _, entry := range r.Entries {
+		if isRepositoryPattern(entry.Name) && matchRepository(entry.Name, name) {
+			return entry, true
+		}
+	}
+	return repositoryConfig{}, false
+}
+
+func (r *Repositories) excluded(name string) bool {
+	for _, pattern := range r.Exclude {
+		if matchRepository(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repositories) resolve(available []string) {
+	var candidates []string
+	if r.Discover == discoverAll {
+		candidates = append(candidates, available...)
+	}
+
+	for _, entry := range r.Entries {
+		if !isRepositoryPattern(entry.Name) {
+			candidates = append(candidates, entry.Name)
+			continue
+		}
+
+		matched := 0
+		for _, name := range available {
+			if matchRepository(entry.Name, name) {
+				candidates = append(candidates, name)
+				matched++
+			}
+		}
+		slog.Info("ecrDiscover", "pattern", entry.Name, "repositories", matched)
+	}
+
+	r.List = nil
+	for _, name := range candidates {
+		if r.excluded(name) || slices.Contains(r.List, name) {
+			continue
+		}
+		r.List = append(r.List, name)
+	}
+}
+
+func (e *ECR) listRepositories() ([]string, error) {
+	paginator := ecr.NewDescribeRepositoriesPaginator(e.ecr, &ecr.DescribeRepositoriesInput{})
+
+	var names []string
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(e.ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range resp.Repositories {
+			names = append(names, *repo.RepositoryName)
+		}
+	}
+
+	slog.Info("ecrDiscover", "repositories", len(names))
+	return names, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRepository(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		matched bool
+	}{
+		{pattern: "team-a/**", name: "team-a/api", matched: true},
+		{pattern: "team-a/**", name: "team-a/api/worker", matched: true},
+		{pattern: "team-a/*", name: "team-a/api/worker", matched: false},
+		{pattern: "team-a/*", name: "team-a/api", matched: true},
+		{pattern: "team-?/api", name: "team-b/api", matched: true},
+		{pattern: "team-a/api", name: "team-a/api", matched: true},
+		{pattern: "team-a/api", name: "team-a/api2", matched: false},
+		{pattern: "team.a/*", name: "team-a/api", matched: false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.matched, matchRepository(test.pattern, test.name), "%s ~ %s", test.pattern, test.name)
+	}
+}
+
+func TestDiscoverRepositories(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	for _, name := range []string{"team-a/api", "team-a/web", "team-a/sandbox/tmp", "team-b/api", "team-c/api"} {
+		registry.repository(name)
+	}
+
+	repositories := createTempConfig(t, `repositories:
+  - name: team-a/**
+    on_conflict: skip
+  - team-c/api
+exclude_repositories:
+  - "**/sandbox/**"
+`)
+	assert.True(t, repositories.needsDiscovery())
+
+	available, err := registry.client().listRepositories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, available, 5, "expected every page of repositories to be listed")
+
+	repositories.resolve(available)
+	assert.Equal(t, []string{"team-a/api", "team-a/web", "team-c/api"}, repositories.List)
+	assert.Equal(t, map[string]string{"team-a/api": conflictSkip, "team-a/web": conflictSkip}, repositories.conflictPolicies())
+}
+
+func TestDiscoverAll(t *testing.T) {
+	repositories := createTempConfig(t, `discover: all
+exclude_repositories:
+  - team-b/*
+`)
+	assert.True(t, repositories.needsDiscovery())
+
+	repositories.resolve([]string{"team-a/api", "team-b/api", "team-c/api"})
+	assert.Equal(t, []string{"team-a/api", "team-c/api"}, repositories.List)
+}
+
+func TestResolveWithoutDiscovery(t *testing.T) {
+	repositories := createTempConfig(t, `repositories:
+  - repo/test/app1
+  - repo/test/app2
+  - repo/test/app1
+exclude_repositories:
+  - repo/test/app2
+`)
+	assert.False(t, repositories.needsDiscovery())
+	assert.Equal(t, []string{"repo/test/app1"}, repositories.List)
+}
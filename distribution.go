@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type distributionClient struct {
+	ctx  context.Context
+	host string
+	auth authorization
+	http *http.Client
+}
+
+func newDistributionClient(ctx context.Context, host string, auth authorization, httpClient *http.Client) *distributionClient {
+	return &distributionClient{
+		ctx:  ctx,
+		host: host,
+		auth: auth,
+		http: httpClient,
+	}
+}
+
+type distributionError struct {
+	method     string
+	url        string
+	statusCode int
+	body       string
+}
+
+func (e *distributionError) Error() string {
+	return fmt.Sprintf("%s %s: status %d: %s", e.method, e.url, e.statusCode, e.body)
+}
+
+func (c *distributionClient) endpoint(format string, a ...any) string {
+	return "https://" + c.host + fmt.Sprintf(format, a...)
+}
+
+func (c *distributionClient) do(method, endpoint string, header http.Header, body io.Reader, size int64, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.SetBasicAuth(c.auth.username, c.auth.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, &distributionError{
+		method:     method,
+		url:        endpoint,
+		statusCode: resp.StatusCode,
+		body:       strings.TrimSpace(string(b)),
+	}
+}
+
+func (c *distributionClient) getManifest(repository, reference string) (manifest, error) {
+	header := http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}}
+
+	resp, err := c.do(http.MethodGet, c.endpoint("/v2/%s/manifests/%s", repository, reference), header, nil, 0, http.StatusOK)
+	if err != nil {
+		return manifest{}, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return manifest{}, err
+	}
+
+	return newManifest(raw, resp.Header.Get("Content-Type"), resp.Header.Get("Docker-Content-Digest")), nil
+}
+
+func (c *distributionClient) putManifest(repository, reference string, m manifest) (string, error) {
+	header := http.Header{"Content-Type": {m.mediaType}}
+
+	resp, err := c.do(http.MethodPut, c.endpoint("/v2/%s/manifests/%s", repository, reference), header, bytes.NewReader(m.raw), int64(len(m.raw)), http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+func (c *distributionClient) blobExists(repository, digest string) (bool, error) {
+	resp, err := c.do(http.MethodHead, c.endpoint("/v2/%s/blobs/%s", repository, digest), nil, nil, 0, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (c *distributionClient) getBlob(repository, digest string) (io.ReadCloser, int64, error) {
+	resp, err := c.do(http.MethodGet, c.endpoint("/v2/%s/blobs/%s", repository, digest), nil, nil, 0, http.StatusOK)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (c *distributionClient) putBlob(repository string, desc ocispec.Descriptor, blob io.Reader) error {
+	start := c.endpoint("/v2/%s/blobs/uploads/", repository)
+	resp, err := c.do(http.MethodPost, start, nil, nil, 0, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	location, err := uploadLocation(start, resp.Header.Get("Location"), desc.Digest.String())
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{
+		"Content-Type":   {"application/octet-stream"},
+		"Content-Length": {strconv.FormatInt(desc.Size, 10)},
+	}
+	resp, err = c.do(http.MethodPut, location, header, blob, desc.Size, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func uploadLocation(base, location, digest string) (string, error) {
+	if location == "" {
+		return "", fmt.Errorf("no upload location returned by %s", base)
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	l, err := b.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	query := l.Query()
+	query.Set("digest", digest)
+	l.RawQuery = query.Encode()
+	return l.String(), nil
+}
+
+type imageReference struct {
+	host       string
+	repository string
+	reference  string
+}
+
+func parseImageReference(name string) (imageReference, error) {
+	host, path, found := strings.Cut(name, "/")
+	if !found || host == "" || path == "" {
+		return imageReference{}, fmt.Errorf("invalid image reference %q", name)
+	}
+
+	if repository, digest, found := strings.Cut(path, "@"); found {
+		return imageReference{host: host, repository: repository, reference: digest}, nil
+	}
+
+	i := strings.LastIndex(path, ":")
+	if i < 0 || strings.Contains(path[i:], "/") {
+		return imageReference{host: host, repository: path, reference: "latest"}, nil
+	}
+
+	return imageReference{host: host, repository: path[:i], reference: path[i+1:]}, nil
+}
+
+type registryCopy struct {
+	source *distributionClient
+	target *distributionClient
+}
+
+func (r registryCopy) getManifest(reference imageReference) (manifest, error) {
+	return r.source.getManifest(reference.repository, reference.reference)
+}
+
+func (r registryCopy) putManifest(reference imageReference, m manifest) (string, error) {
+	return r.target.putManifest(reference.repository, reference.reference, m)
+}
+
+func (r registryCopy) copyBlobs(from, to imageReference, blobs []ocispec.Descriptor) error {
+	for _, desc := range blobs {
+		if err := r.copyBlob(from, to, desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r registryCopy) copyBlob(from, to imageReference, desc ocispec.Descriptor) error {
+	exists, err := r.target.blobExists(to.repository, desc.Digest.String())
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		slog.Info("blobCopy", "repository", to.repository, "digest", desc.Digest, "status", "already exists")
+		return nil
+	}
+
+	blob, size, err := r.source.getBlob(from.repository, desc.Digest.String())
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	if desc.Size == 0 {
+		desc.Size = size
+	}
+
+	if err := r.target.putBlob(to.repository, desc, blob); err != nil {
+		return err
+	}
+
+	slog.Info("blobCopy", "repository", to.repository, "digest", desc.Digest, "size", desc.Size, "status", "copied")
+	return nil
+}
+
+type Distribution struct {
+	ctx        context.Context
+	http       *http.Client
+	authSource tokenSource
+	authTarget tokenSource
+	platforms  []ocispec.Platform
+}
+
+func newDistribution(authSource, authTarget tokenSource) *Distribution {
+	return &Distribution{
+		ctx:        context.Background(),
+		http:       http.DefaultClient,
+		authSource: authSource,
+		authTarget: authTarget,
+	}
+}
+
+func (d *Distribution) withContext(ctx context.Context) *Distribution {
+	d.ctx = ctx
+	return d
+}
+
+func (d *Distribution) withPlatforms(platforms []ocispec.Platform) *Distribution {
+	d.platforms = platforms
+	return d
+}
+
+func (d *Distribution) copy(image copyImage) (string, error) {
+	from, err := parseImageReference(image.from)
+	if err != nil {
+		return "", err
+	}
+
+	to, err := parseImageReference(image.to)
+	if err != nil {
+		return "", err
+	}
+
+	authSource, err := d.authSource.token()
+	if err != nil {
+		return "", err
+	}
+
+	authTarget, err := d.authTarget.token()
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := copyManifest(registryCopy{
+		source: newDistributionClient(d.ctx, from.host, authSource, d.http),
+		target: newDistributionClient(d.ctx, to.host, authTarget, d.http),
+	}, from, to, d.platforms)
+	if err != nil && expiredToken(err) {
+		d.authSource.expire()
+		d.authTarget.expire()
+	}
+	return digest, err
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected imageReference
+	}{
+		{
+			name:     "123456789012.dkr.ecr.us-east-1.amazonaws.com/repo/test/app1:1.0",
+			expected: imageReference{host: "123456789012.dkr.ecr.us-east-1.amazonaws.com", repository: "repo/test/app1", reference: "1.0"},
+		},
+		{
+			name:     "localhost:5000/repo/test/app1",
+			expected: imageReference{host: "localhost:5000", repository: "repo/test/app1", reference: "latest"},
+		},
+		{
+			name:     "localhost:5000/app@sha256:abc",
+			expected: imageReference{host: "localhost:5000", repository: "app", reference: "sha256:abc"},
+		},
+	}
+
+	for _, test := range tests {
+		ref, err := parseImageReference(test.name)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, ref)
+	}
+
+	_, err := parseImageReference("alpine")
+	assert.Error(t, err)
+}
+
+func TestDistributionCopy(t *testing.T) {
+	authSource := authorization{username: "AWS", password: "source"}
+	authTarget := authorization{username: "AWS", password: "target"}
+
+	sourceRegistry, sourceServer := newFakeRegistry(authSource)
+	defer sourceServer.Close()
+
+	targetRegistry, targetServer := newFakeRegistry(authTarget)
+	defer targetServer.Close()
+
+	sourceImage, err := sourceRegistry.addImage("repo/test/app1", "1.0", []byte("layer-1"), []byte("layer-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := targetRegistry.addBlob([]byte("layer-1"))
+
+	sourceURL, _ := url.Parse(sourceServer.URL)
+	targetURL, _ := url.Parse(targetServer.URL)
+
+	distribution := newDistribution(authSource, authTarget)
+	distribution.http = sourceServer.Client()
+
+	_, err = distribution.copy(copyImage{
+		from: sourceURL.Host + "/repo/test/app1:1.0",
+		to:   targetURL.Host + "/platform/app1:1.0",
+	})
+	assert.NoError(t, err)
+
+	targetImage, found := targetRegistry.manifest("platform/app1", "1.0")
+	assert.True(t, found, "expected manifest to be pushed to the target")
+	assert.Equal(t, sourceImage.digest, targetImage.digest)
+	assert.Equal(t, sourceImage.mediaType, targetImage.mediaType)
+	assert.Len(t, targetRegistry.blobs, 3)
+	assert.Contains(t, targetRegistry.blobs, shared.Digest.String())
+	assert.Equal(t, 2, targetRegistry.uploads, "expected the shared layer not to be uploaded again")
+}
+
+func TestDistributionCopyUnauthorized(t *testing.T) {
+	auth := authorization{username: "AWS", password: "source"}
+
+	sourceRegistry, sourceServer := newFakeRegistry(auth)
+	defer sourceServer.Close()
+
+	if _, err := sourceRegistry.addImage("repo/test/app1", "1.0", []byte("layer")); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceURL, _ := url.Parse(sourceServer.URL)
+
+	distribution := newDistribution(authorization{username: "AWS", password: "wrong"}, auth)
+	distribution.http = sourceServer.Client()
+
+	_, err := distribution.copy(copyImage{
+		from: sourceURL.Host + "/repo/test/app1:1.0",
+		to:   sourceURL.Host + "/repo/test/app2:1.0",
+	})
+
+	var distributionErr *distributionError
+	assert.ErrorAs(t, err, &distributionErr)
+	assert.Equal(t, 401, distributionErr.statusCode)
+}
+
+func TestDistributionCopyByDigest(t *testing.T) {
+	auth := authorization{username: "AWS", password: "token"}
+
+	registry, server := newFakeRegistry(auth)
+	defer server.Close()
+
+	sourceImage, err := registry.addImage("repo/test/app1", "1.0", []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, _ := url.Parse(server.URL)
+
+	distribution := newDistribution(auth, auth)
+	distribution.http = server.Client()
+
+	_, err = distribution.copy(copyImage{
+		from: host.Host + "/repo/test/app1@" + sourceImage.digest,
+		to:   host.Host + "/repo/test/app2@" + sourceImage.digest,
+	})
+	assert.NoError(t, err)
+
+	targetImage, found := registry.manifest("repo/test/app2", sourceImage.digest)
+	assert.True(t, found, "expected manifest to be pushed by digest")
+	assert.Equal(t, sourceImage.digest, targetImage.digest)
+}
+
+func TestDistributionCopyIndex(t *testing.T) {
+	auth := authorization{username: "AWS", password: "token"}
+
+	sourceRegistry, sourceServer := newFakeRegistry(auth)
+	defer sourceServer.Close()
+
+	targetRegistry, targetServer := newFakeRegistry(auth)
+	defer targetServer.Close()
+
+	amd64 := ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := ocispec.Platform{OS: "linux", Architecture: "arm64"}
+
+	sourceIndex, err := sourceRegistry.addIndex("repo/test/app1", "1.0", amd64, arm64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourceURL, _ := url.Parse(sourceServer.URL)
+	targetURL, _ := url.Parse(targetServer.URL)
+
+	distribution := newDistribution(auth, auth)
+	distribution.http = sourceServer.Client()
+
+	_, err = distribution.copy(copyImage{
+		from: sourceURL.Host + "/repo/test/app1:1.0",
+		to:   targetURL.Host + "/repo/test/app1:1.0",
+	})
+	assert.NoError(t, err)
+
+	targetIndex, found := targetRegistry.manifest("repo/test/app1", "1.0")
+	assert.True(t, found)
+	assert.Equal(t, sourceIndex.digest, targetIndex.digest, "expected the index digest to be preserved")
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		child, _ := sourceRegistry.manifest("repo/test/app1", arch)
+		_, found := targetRegistry.manifest("repo/test/app1", child.digest)
+		assert.True(t, found, "expected %s manifest to be copied", arch)
+	}
+
+	distribution.withPlatforms([]ocispec.Platform{arm64})
+	_, err = distribution.copy(copyImage{
+		from: sourceURL.Host + "/repo/test/app1:1.0",
+		to:   targetURL.Host + "/repo/test/app2:1.0",
+	})
+	assert.NoError(t, err)
+
+	filteredIndex, found := targetRegistry.manifest("repo/test/app2", "1.0")
+	assert.True(t, found)
+	assert.NotEqual(t, sourceIndex.digest, filteredIndex.digest)
+
+	amd64Image, _ := sourceRegistry.manifest("repo/test/app1", "amd64")
+	_, found = targetRegistry.manifest("repo/test/app2", amd64Image.digest)
+	assert.False(t, found, "expected amd64 manifest to be filtered out")
+}
@@ -5,8 +5,9 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
@@ -17,12 +18,20 @@ type Docker struct {
 	ctx        context.Context
 	cli        *client.Client
 	args       *Args
+	source     *ECR
+	target     *ECR
 	count      int
 	data       metadataList
 	pushch     chan uploadImage
 	metadatach chan repositoryMetadata
 	done       chan struct{}
 	donepushch chan struct{}
+	checkpoint *Checkpoint
+	progress   func(progressEvent)
+	retry      *retryPolicy
+	shutdown   *shutdown
+	report     *migrationReport
+	failures   failureList
 }
 
 func newDocker() *Docker {
@@ -31,16 +40,18 @@ func newDocker() *Docker {
 		count:      0,
 		done:       make(chan struct{}),
 		donepushch: make(chan struct{}),
+		progress:   logProgress,
+		retry:      newRetryPolicy(),
 	}
 }
 
-func (d *Docker) mustStartCli() *Docker {
+func (d *Docker) startCli() (*Docker, error) {
 	cli, err := client.NewClientWithOpts()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	d.cli = cli
-	return d
+	return d, nil
 }
 
 func (d *Docker) withArgs(args *Args) *Docker {
@@ -48,54 +59,116 @@ func (d *Docker) withArgs(args *Args) *Docker {
 	return d
 }
 
+func (d *Docker) withSource(source *ECR) *Docker {
+	d.source = source
+	return d
+}
+
+func (d *Docker) withTarget(target *ECR) *Docker {
+	d.target = target
+	return d
+}
+
+func (d *Docker) withProgress(progress func(progressEvent)) *Docker {
+	d.progress = progress
+	return d
+}
+
+func (d *Docker) withShutdown(shutdown *shutdown) *Docker {
+	d.shutdown = shutdown
+	d.ctx = shutdown.ctx
+	return d
+}
+
+func (d *Docker) withReport(report *migrationReport) *Docker {
+	d.report = report
+	return d
+}
+
+func (d *Docker) withRetry(retry *retryPolicy) *Docker {
+	d.retry = retry
+	return d
+}
+
+func (d *Docker) withCheckpoint(checkpoint *Checkpoint) *Docker {
+	d.checkpoint = checkpoint
+	return d
+}
+
 func (d *Docker) addMetadataList(metadataList metadataList) *Docker {
 	d.data = metadataList
 	return d
 }
 
-func (d *Docker) migrate() *Docker {
-	auth := d.authorize(d.data.auth)
+func (d *Docker) migrate() error {
+	authTarget, targetRepositoriesMetadata, failed, err := d.target.prepare(d.data)
+	if err != nil {
+		return err
+	}
 
-	authTarget, targetRepositoriesMetadata := d.prepare()
+	source := newTokenProvider(d.source).withToken(d.data.auth)
+	target := newTokenProvider(d.target).withToken(authTarget)
 
 	d.channels()
 
 	for _, metadata := range d.data.repoList {
+		if err, found := failed[metadata.repositoryName]; found {
+			d.failures.addRepository(metadata.repositoryName, metadata.tags, err)
+			d.report.addFailed(metadata, metadata.tags, err)
+			continue
+		}
 		d.metadatach <- metadata
 	}
 	close(d.metadatach)
 
 	for i := 0; i < d.args.pullers; i++ {
 		go func() {
-			d.pullers(auth, targetRepositoriesMetadata)
+			d.pullers(source, targetRepositoriesMetadata)
 		}()
 	}
 
 	go d.waitPullers()
 	for i := 0; i < d.args.pushers; i++ {
 		go func() {
-			d.pushers(authTarget)
+			d.pushers(target)
 		}()
 	}
 
 	d.waitPushers()
-	return d
+	return d.failures.err()
 }
 
-func (d *Docker) pushers(auth string) {
+func (d *Docker) pushers(target tokenSource) {
 	defer func() {
 		d.donepushch <- struct{}{}
 		slog.Info("pusher", "status", "terminated")
 	}()
 
 	for image := range d.pushch {
-		if err := d.push(auth, image); err != nil {
+		var digest string
+		attempts, err := d.retry.run("imagePushing", func() error {
+			auth, err := d.registryAuth(target)
+			if err != nil {
+				return err
+			}
+			digest, err = d.push(auth, image)
+			if err == nil {
+				err = d.verify(image, digest)
+			}
+			return d.expireOn(err, target)
+		})
+		d.report.add(image.report.finish(image.started, attempts, err).pushed(digest))
+		if err != nil {
 			slog.Error("imagePushing", "image", image.name, "error", err)
+			d.checkpoint.set(image.repositoryName, image.reference, stateFailed, err)
+			d.failures.add(image.repositoryName, image.reference, err)
+			continue
 		}
+		d.checkpoint.pushed(image.repositoryName, image.reference, stateVerified, digest)
 	}
 }
 
-func (d *Docker) pullers(auth string, targetRepositoriesMetadata map[string]repositoryMetadata) {
+func (d *Docker) pullers(source tokenSource, targetRepositoriesMetadata map[string]repositoryMetadata) {
 	defer func() {
 		d.done <- struct{}{}
 		slog.Info("puller", "status", "exited")
@@ -105,42 +178,89 @@ func (d *Docker) pullers(auth string, targetRepositoriesMetadata map[string]repo
 		for _, tag := range metadata.tags {
 			from, to := generateECRImageNames(
 				targetRepositoriesMetadata,
-				metadata.repositoryName,
+				metadata.targetRepository(),
 				metadata.repositoryURI,
 				tag,
+				metadata.targetReference(tag),
 			)
+			entry := newReportEntry(metadata, tag, from, to)
 
-			docker, err := d.pull(auth, downloadImage{name: from})
+			if d.shutdown.stopping() {
+				d.failures.cancel(metadata.repositoryName, tag)
+				d.report.add(entry.with(outcomeCancelled))
+				continue
+			}
+
+			if d.checkpoint.completed(metadata.repositoryName, tag) {
+				slog.Info("imagePulling", "repositoryName", metadata.repositoryName, "tag", tag, "status", "already migrated")
+				d.report.add(entry.pushed(d.checkpoint.digest(metadata.repositoryName, tag)).with(outcomeMigrated))
+				continue
+			}
+			d.checkpoint.set(metadata.repositoryName, tag, stateDiscovered, nil)
+			d.failures.attempt()
+
+			started := time.Now()
+			attempts, err := d.retry.run("imagePulling", func() error {
+				if err := d.singlePlatform(metadata.repositoryName, tag); err != nil {
+					return err
+				}
+				auth, err := d.registryAuth(source)
+				if err != nil {
+					return err
+				}
+				_, err = d.pull(auth, downloadImage{name: from})
+				return d.expireOn(err, source)
+			})
 			if err != nil {
+				d.report.add(entry.finish(started, attempts, err))
 				slog.Error("imagePulling", "repositoryName", metadata.repositoryName, "tag", tag, "error", err)
+				d.checkpoint.set(metadata.repositoryName, tag, stateFailed, err)
+				d.failures.add(metadata.repositoryName, tag, err)
 				continue
 			}
 
-			if err := docker.rename(from, to); err != nil {
+			if err := d.rename(from, to); err != nil {
+				d.report.add(entry.finish(started, attempts, err))
 				slog.Error("renaming", "from", from, "to", to, "error", err)
+				d.checkpoint.set(metadata.repositoryName, tag, stateFailed, err)
+				d.failures.add(metadata.repositoryName, tag, err)
 				continue
 			}
+			d.checkpoint.set(metadata.repositoryName, tag, statePulled, nil)
 
 			d.pushch <- uploadImage{
-				name: to,
+				name:             to,
+				repositoryName:   metadata.repositoryName,
+				reference:        tag,
+				targetRepository: metadata.targetRepository(),
+				targetReference:  metadata.targetReference(tag),
+				report:           entry.finish(started, attempts, nil),
+				started:          started,
 			}
 		}
 	}
 }
 
-func generateECRImageNames(tgRepoMetadata map[string]repositoryMetadata, repositoryName, repositoryURI, tag string) (imageSource, imageTarget string) {
-	value, found := tgRepoMetadata[repositoryName]
+func generateECRImageNames(tgRepoMetadata map[string]repositoryMetadata, targetRepositoryName, repositoryURI, reference, targetReference string) (imageSource, imageTarget string) {
+	value, found := tgRepoMetadata[targetRepositoryName]
 	if !found {
 		return "", ""
 	}
 	{
-		imageSource = fmt.Sprintf("%s:%s", repositoryURI, tag)
-		imageTarget = fmt.Sprintf("%s:%s", value.repositoryURI, tag)
+		imageSource = fmt.Sprintf("%s%s%s", repositoryURI, referenceSeparator(reference), reference)
+		imageTarget = fmt.Sprintf("%s%s%s", value.repositoryURI, referenceSeparator(targetReference), targetReference)
 	}
 
 	return imageSource, imageTarget
 }
 
+func referenceSeparator(reference string) string {
+	if strings.HasPrefix(reference, "sha256:") {
+		return "@"
+	}
+	return ":"
+}
+
 type downloadImage struct {
 	name string
 }
@@ -155,27 +275,66 @@ func (d *Docker) pull(auth string, img downloadImage) (*Docker, error) {
 	}
 
 	defer out.Close()
-	io.Copy(io.Discard, out)
+	if _, err := decodeStream(img.name, out, d.progress); err != nil {
+		return &Docker{}, err
+	}
+
 	slog.Info("imagePulling", "image", img.name, "status", "pulled")
-	return d, err
+	return d, nil
 }
 
-func (d *Docker) push(auth string, upload uploadImage) error {
+func (d *Docker) push(auth string, upload uploadImage) (string, error) {
 	out, err := d.cli.ImagePush(d.ctx, upload.name, image.PushOptions{
 		RegistryAuth: auth,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	defer out.Close()
-	io.Copy(io.Discard, out)
-	slog.Info("imagePushing", "image", upload.name, "status", "pushed")
-	return err
+	digest, err := decodeStream(upload.name, out, d.progress)
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("imagePushing", "image", upload.name, "digest", digest, "status", "pushed")
+	return digest, nil
+}
+
+func (d *Docker) singlePlatform(repository, tag string) error {
+	m, err := d.source.getImageManifest(repository, tag)
+	if err != nil {
+		return err
+	}
+
+	if m.isIndex() {
+		return fmt.Errorf("%s:%s is a multi-platform image, copying it requires the registry or ecr engine", repository, tag)
+	}
+	return nil
+}
+
+func (d *Docker) verify(upload uploadImage, digest string) error {
+	m, err := d.target.getImageManifest(upload.targetRepository, upload.targetReference)
+	if err != nil {
+		return err
+	}
+
+	if digest != "" && m.digest != digest {
+		return fmt.Errorf("digest mismatch for %s, pushed %s but target has %s", upload.name, digest, m.digest)
+	}
+
+	slog.Info("imagePushing", "image", upload.name, "digest", m.digest, "status", "verified")
+	return nil
 }
 
 type uploadImage struct {
-	name string
+	name             string
+	repositoryName   string
+	reference        string
+	targetRepository string
+	targetReference  string
+	report           reportEntry
+	started          time.Time
 }
 
 func (d *Docker) rename(from, to string) error {
@@ -188,7 +347,7 @@ func (d *Docker) rename(from, to string) error {
 	return err
 }
 
-func (d *Docker) authorize(auth authorization) string {
+func (d *Docker) authorize(auth authorization) (string, error) {
 	authConfig := registry.AuthConfig{
 		Username: auth.username,
 		Password: auth.password,
@@ -196,38 +355,25 @@ func (d *Docker) authorize(auth authorization) string {
 
 	encondedJSON, err := json.Marshal(authConfig)
 	if err != nil {
-		panic(err)
+		return "", authErr(err)
 	}
 
-	return base64.URLEncoding.EncodeToString(encondedJSON)
+	return base64.URLEncoding.EncodeToString(encondedJSON), nil
 }
 
-func (d *Docker) createDestinationECRClient() *ECR {
-	aws := mustInitConfig(
-		withRegion(d.args.toRegion),
-		withProfile(d.args.toProfile),
-	)
-
-	svc := aws.stablishClientWith(
-		ecrService(aws.cfg),
-	)
-
-	return newEcr(svc.ecr)
-}
-
-func (d *Docker) prepare() (string, map[string]repositoryMetadata) {
-	ecrRegistry := d.createDestinationECRClient()
-
-	repositories := ecrRegistry.validate(d.data)
-	targetRepositoriesMetadata := ecrRegistry.getRepositoryMetadata(repositories)
-
-	token, err := ecrRegistry.authenticate()
+func (d *Docker) registryAuth(c tokenSource) (string, error) {
+	auth, err := c.token()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
+	return d.authorize(auth)
+}
 
-	authTarget := d.authorize(token)
-	return authTarget, targetRepositoriesMetadata
+func (d *Docker) expireOn(err error, c tokenSource) error {
+	if err != nil && expiredToken(err) {
+		c.expire()
+	}
+	return err
 }
 
 func (d *Docker) waitPullers() {
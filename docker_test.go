@@ -2,6 +2,9 @@ package main
 
 import (
 	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
 )
 
 type (
@@ -37,9 +40,12 @@ func TestMigrate(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	repositories, err := newRepositoryFinder().locateIn(fileName).registryList()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	var (
-		repoFinder     = newRepositoryFinder()
-		repositories   = repoFinder.locateIn(fileName).registryList()
 		svcFrom, svcTo = ecrClients(ecrConfig)
 		ecrRegistry    = newEcr(svcFrom.ecr)
 		uriImages      = createImageURI(svcFrom.sts, ecrConfig.fromRegion, repositories.List)
@@ -65,8 +71,11 @@ func TestMigrate(t *testing.T) {
 		pullers:     ecrConfig.pullers,
 	}
 
-	docker := newDocker().mustStartCli().withArgs(args)
-	token := docker.authorize(auth)
+	docker := newDocker().mustStartCli().withArgs(args).withTarget(newEcr(svcTo.ecr))
+	token, err := docker.authorize(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	ecrImageConfigs := generateConfigs(repositories.List, uriImages)
 	for _, ic := range ecrImageConfigs {
@@ -81,14 +90,16 @@ func TestMigrate(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if err := docker.push(token, uploadImage{name: to}); err != nil {
+			if _, err := docker.push(token, uploadImage{name: to}); err != nil {
 				t.Fatal(err)
 			}
 		}
 	}
 
-	imageMetadataList := ecrRegistry.walk(repositories.List)
-	docker.addMetadataList(imageMetadataList).migrate()
+	imageMetadataList := mustWalk(t, ecrRegistry, repositories.List)
+	if err := docker.addMetadataList(imageMetadataList).migrate(); err != nil {
+		t.Fatal(err)
+	}
 
 	if err := delete(svcFrom.ecr, repositories.List); err != nil {
 		t.Fatal(err)
@@ -98,3 +109,18 @@ func TestMigrate(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDockerMultiPlatform(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	registry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer"))
+	registry.addIndex("repo/test/app1", []string{"2.0"},
+		ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		ocispec.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	docker := newDocker().withSource(registry.client())
+	assert.NoError(t, docker.singlePlatform("repo/test/app1", "1.0"))
+	assert.ErrorContains(t, docker.singlePlatform("repo/test/app1", "2.0"), "requires the registry or ecr engine")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+type progressEvent struct {
+	image   string
+	layer   string
+	status  string
+	current int64
+	total   int64
+}
+
+func (e progressEvent) completed() bool {
+	switch e.status {
+	case "Pull complete", "Already exists", "Pushed", "Layer already exists":
+		return true
+	}
+	return strings.HasPrefix(e.status, "Mounted from")
+}
+
+func logProgress(event progressEvent) {
+	if event.completed() {
+		slog.Info("layerProgress", "image", event.image, "layer", event.layer, "status", event.status)
+		return
+	}
+	slog.Debug("layerProgress", "image", event.image, "layer", event.layer, "current", event.current, "total", event.total, "status", event.status)
+}
+
+type pushResult struct {
+	Tag    string `json:"Tag"`
+	Digest string `json:"Digest"`
+	Size   int64  `json:"Size"`
+}
+
+func decodeStream(image string, r io.Reader, progress func(progressEvent)) (string, error) {
+	var digest string
+	decoder := json.NewDecoder(r)
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return digest, nil
+			}
+			return "", err
+		}
+
+		if message.Error != nil {
+			return "", message.Error
+		}
+		if message.ErrorMessage != "" {
+			return "", errors.New(message.ErrorMessage)
+		}
+
+		if message.Aux != nil {
+			var result pushResult
+			if err := json.Unmarshal(*message.Aux, &result); err == nil && result.Digest != "" {
+				digest = result.Digest
+			}
+		}
+		if found, ok := strings.CutPrefix(message.Status, "Digest: "); ok {
+			digest = found
+		}
+
+		if progress == nil || message.ID == "" {
+			continue
+		}
+
+		event := progressEvent{
+			image:  image,
+			layer:  message.ID,
+			status: message.Status,
+		}
+		if message.Progress != nil {
+			event.current = message.Progress.Current
+			event.total = message.Progress.Total
+		}
+		progress(event)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeStream(t *testing.T) {
+	stream := `{"status":"The push refers to repository [222222222222.dkr.ecr.us-east-1.amazonaws.com/repo/test/app1]"}
+{"status":"Preparing","progressDetail":{},"id":"a1"}
+{"status":"Pushing","progressDetail":{"current":512,"total":1024},"id":"a1"}
+{"status":"Pushed","progressDetail":{},"id":"a1"}
+{"status":"Mounted from repo/test/app2","progressDetail":{},"id":"b2"}
+{"status":"1.0: digest: sha256:abc size: 528"}
+{"progressDetail":{},"aux":{"Tag":"1.0","Digest":"sha256:abc","Size":528}}
+`
+
+	var events []progressEvent
+	digest, err := decodeStream("repo/test/app1:1.0", strings.NewReader(stream), func(event progressEvent) {
+		events = append(events, event)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:abc", digest, "expected the pushed digest from the aux message")
+
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, progressEvent{image: "repo/test/app1:1.0", layer: "a1", status: "Pushing", current: 512, total: 1024}, events[1])
+		assert.False(t, events[1].completed())
+		assert.True(t, events[2].completed())
+		assert.True(t, events[3].completed())
+	}
+}
+
+func TestDecodeStreamError(t *testing.T) {
+	stream := `{"status":"Preparing","progressDetail":{},"id":"a1"}
+{"errorDetail":{"message":"tag invalid: The image tag '1.0' already exists and cannot be overwritten because the repository is immutable."},"error":"tag invalid"}
+`
+
+	_, err := decodeStream("repo/test/app1:1.0", strings.NewReader(stream), nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "immutable")
+	}
+
+	_, err = decodeStream("repo/test/app1:1.0", strings.NewReader(`{"status":`), nil)
+	assert.Error(t, err)
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
@@ -14,8 +16,14 @@ import (
 )
 
 type ECR struct {
-	ecr *ecr.Client
-	ctx context.Context
+	ecr               *ecr.Client
+	ctx               context.Context
+	untagged          bool
+	filters           tagFilters
+	lifecycle         lifecyclePolicy
+	kmsKeys           map[string]string
+	reconcileExisting bool
+	policyRewrite     policyRewrite
 }
 
 func newEcr(ecr *ecr.Client) *ECR {
@@ -25,10 +33,46 @@ func newEcr(ecr *ecr.Client) *ECR {
 	}
 }
 
+func (e *ECR) withContext(ctx context.Context) *ECR {
+	e.ctx = ctx
+	return e
+}
+
+func (e *ECR) withUntagged(untagged bool) *ECR {
+	e.untagged = untagged
+	return e
+}
+
+func (e *ECR) withFilters(filters tagFilters) *ECR {
+	e.filters = filters
+	return e
+}
+
+func (e *ECR) withPolicyRewrite(rewrite policyRewrite) *ECR {
+	e.policyRewrite = rewrite
+	return e
+}
+
+func (e *ECR) withKmsKeys(kmsKeys map[string]string) *ECR {
+	e.kmsKeys = kmsKeys
+	return e
+}
+
+func (e *ECR) withReconcileSettings(reconcile bool) *ECR {
+	e.reconcileExisting = reconcile
+	return e
+}
+
+func (e *ECR) withLifecyclePolicy(lifecycle lifecyclePolicy) *ECR {
+	e.lifecycle = lifecycle
+	return e
+}
+
 type metadataList struct {
 	auth        authorization
 	repoList    []repositoryMetadata
 	imagesCount int
+	conflicts   []conflict
 }
 
 type repositoryMetadata struct {
@@ -36,26 +80,97 @@ type repositoryMetadata struct {
 	repositoryPolicy string
 	repositoryName   string
 	tags             []string
+	digests          []string
+	upToDate         []string
+	retags           map[string]string
+	conflicts        map[string]conflict
+	targetName       string
+	lifecyclePolicy  string
+	settings         repositorySettings
+	images           map[string]imageDetail
 }
 
-func (e *ECR) getRepositoryMetadata(repoList []string) map[string]repositoryMetadata {
-	m := make(map[string]repositoryMetadata, len(repoList))
-	resp, err := e.ecr.DescribeRepositories(e.ctx, &ecr.DescribeRepositoriesInput{
-		RepositoryNames: repoList,
-	})
+func (m repositoryMetadata) targetRepository() string {
+	if m.targetName != "" {
+		return m.targetName
+	}
+	return m.repositoryName
+}
+
+func (m repositoryMetadata) targetReference(reference string) string {
+	if retag, found := m.retags[reference]; found {
+		return retag
+	}
+	return reference
+}
+
+const describeRepositoriesBatchSize = 100
+
+func (e *ECR) getRepositoryMetadata(repoList []string) (map[string]repositoryMetadata, error) {
+	repositories, err := e.describeRepositories(repoList)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, repo := range resp.Repositories {
+	m := make(map[string]repositoryMetadata, len(repositories))
+	for _, repo := range repositories {
 		m[*repo.RepositoryName] = repositoryMetadata{
 			repositoryName:   *repo.RepositoryName,
 			repositoryURI:    *repo.RepositoryUri,
 			repositoryPolicy: e.pullPolicy(*repo.RepositoryName),
+			lifecyclePolicy:  e.pullLifecyclePolicy(*repo.RepositoryName),
+			settings:         e.pullSettings(repo),
+		}
+	}
+
+	return m, nil
+}
+
+func (e *ECR) getRepositoryURIs(repoList []string) (map[string]repositoryMetadata, error) {
+	repositories, err := e.describeRepositories(repoList)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]repositoryMetadata, len(repositories))
+	for _, repo := range repositories {
+		m[*repo.RepositoryName] = repositoryMetadata{
+			repositoryName: *repo.RepositoryName,
+			repositoryURI:  *repo.RepositoryUri,
+		}
+	}
+
+	return m, nil
+}
+
+func (e *ECR) describeRepositories(repoList []string) ([]types.Repository, error) {
+	var repositories []types.Repository
+	for _, batch := range chunk(repoList, describeRepositoriesBatchSize) {
+		paginator := ecr.NewDescribeRepositoriesPaginator(e.ecr, &ecr.DescribeRepositoriesInput{
+			RepositoryNames: batch,
+		})
+
+		for paginator.HasMorePages() {
+			resp, err := paginator.NextPage(e.ctx)
+			if err != nil {
+				return nil, fmt.Errorf("describing repositories: %w", err)
+			}
+			repositories = append(repositories, resp.Repositories...)
 		}
 	}
 
-	return m
+	return repositories, nil
+}
+
+func chunk(list []string, size int) [][]string {
+	chunks := make([][]string, 0, (len(list)+size-1)/size)
+	for size < len(list) {
+		list, chunks = list[size:], append(chunks, list[:size])
+	}
+	if len(list) > 0 {
+		chunks = append(chunks, list)
+	}
+	return chunks
 }
 
 func (e *ECR) pullPolicy(repositoryName string) string {
@@ -77,8 +192,9 @@ func (e *ECR) pullPolicy(repositoryName string) string {
 }
 
 type authorization struct {
-	username string
-	password string
+	username  string
+	password  string
+	expiresAt time.Time
 }
 
 func (e *ECR) authenticate() (authorization, error) {
@@ -100,17 +216,21 @@ func (e *ECR) authenticate() (authorization, error) {
 	auth := strings.Split(string(token), ":")
 
 	return authorization{
-		username: auth[0],
-		password: auth[1],
+		username:  auth[0],
+		password:  auth[1],
+		expiresAt: aws.ToTime(authData.ExpiresAt),
 	}, nil
 }
 
-func (e *ECR) walk(repoList []string) metadataList {
-	data := e.getRepositoryMetadata(repoList)
+func (e *ECR) walk(repoList []string) (metadataList, error) {
+	data, err := e.getRepositoryMetadata(repoList)
+	if err != nil {
+		return metadataList{}, err
+	}
 
 	auth, err := e.authenticate()
 	if err != nil {
-		panic(err)
+		return metadataList{}, authErr(err)
 	}
 
 	metadata := metadataList{
@@ -119,32 +239,202 @@ func (e *ECR) walk(repoList []string) metadataList {
 
 	counter := 0
 	for _, repository := range repoList {
-		list, err := e.ecr.ListImages(e.ctx, &ecr.ListImagesInput{
-			RepositoryName: aws.String(repository),
-		})
-
+		tags, digests, err := e.listImages(repository)
 		if err != nil {
-			slog.Error("listing ecr images", "error", err)
-			continue
+			return metadataList{}, fmt.Errorf("listing images of %s: %w", repository, err)
 		}
 
-		tags := make([]string, len(list.ImageIds))
-		for i, image := range list.ImageIds {
-			if *image.ImageTag != "" {
-				tags[i] = *image.ImageTag
-				slog.Info("ecrListing", "repository", repository, "tag", *image.ImageTag)
-				counter++
-			}
+		if tags, err = e.filterTags(repository, tags); err != nil {
+			return metadataList{}, fmt.Errorf("filtering images of %s: %w", repository, err)
 		}
 
+		slog.Info("ecrWalk", "repository", repository, "images", len(tags), "untagged", len(digests))
+		counter += len(tags) + len(digests)
+
 		if repositoryValue, found := data[repository]; found {
 			repositoryValue.tags = tags
+			repositoryValue.digests = digests
 			metadata.repoList = append(metadata.repoList, repositoryValue)
 		}
 	}
 
 	metadata.imagesCount = counter
-	return metadata
+	slog.Info("ecrWalk", "repositories", len(metadata.repoList), "images", counter)
+	return metadata, nil
+}
+
+func (e *ECR) filterTags(repository string, tags []string) ([]string, error) {
+	filters := e.filters.forRepository(repository)
+	if len(filters) == 0 {
+		return tags, nil
+	}
+
+	var details map[string]imageDetail
+	for _, filter := range filters {
+		if filter.needsDetails() && details == nil {
+			var err error
+			if details, err = e.describeImages(repository); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	discovered := len(tags)
+	for _, filter := range filters {
+		tags = filter.apply(tags, details)
+	}
+
+	slog.Info("ecrFilter", "repository", repository, "discovered", discovered, "selected", len(tags))
+	return tags, nil
+}
+
+func (e *ECR) listImages(repository string) ([]string, []string, error) {
+	filter := &types.ListImagesFilter{TagStatus: types.TagStatusTagged}
+	if e.untagged {
+		filter.TagStatus = types.TagStatusAny
+	}
+
+	paginator := ecr.NewListImagesPaginator(e.ecr, &ecr.ListImagesInput{
+		RepositoryName: aws.String(repository),
+		Filter:         filter,
+	})
+
+	var tags, digests []string
+	for paginator.HasMorePages() {
+		list, err := paginator.NextPage(e.ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, image := range list.ImageIds {
+			if aws.ToString(image.ImageTag) != "" {
+				tags = append(tags, *image.ImageTag)
+				slog.Info("ecrListing", "repository", repository, "tag", *image.ImageTag)
+				continue
+			}
+
+			if aws.ToString(image.ImageDigest) != "" {
+				digests = append(digests, *image.ImageDigest)
+				slog.Info("ecrListing", "repository", repository, "digest", *image.ImageDigest)
+			}
+		}
+	}
+
+	return tags, digests, nil
+}
+
+type imageDetail struct {
+	digest   string
+	tags     []string
+	size     int64
+	pushedAt time.Time
+}
+
+func (e *ECR) describeImages(repository string) (map[string]imageDetail, error) {
+	paginator := ecr.NewDescribeImagesPaginator(e.ecr, &ecr.DescribeImagesInput{
+		RepositoryName: aws.String(repository),
+	})
+
+	details := make(map[string]imageDetail)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(e.ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, image := range resp.ImageDetails {
+			detail := imageDetail{
+				digest:   aws.ToString(image.ImageDigest),
+				tags:     image.ImageTags,
+				size:     aws.ToInt64(image.ImageSizeInBytes),
+				pushedAt: aws.ToTime(image.ImagePushedAt),
+			}
+
+			details[detail.digest] = detail
+			for _, tag := range detail.tags {
+				details[tag] = detail
+			}
+		}
+	}
+
+	return details, nil
+}
+
+type imageComparison struct {
+	source map[string]imageDetail
+	target map[string]imageDetail
+	exists bool
+}
+
+func (e *ECR) compareImages(target *ECR, metadata repositoryMetadata) (imageComparison, error) {
+	source, err := e.describeImages(metadata.repositoryName)
+	if err != nil {
+		return imageComparison{}, err
+	}
+
+	comparison := imageComparison{
+		source: source,
+		target: map[string]imageDetail{},
+		exists: target.exists(metadata.targetRepository()),
+	}
+
+	if comparison.exists {
+		if comparison.target, err = target.describeImages(metadata.targetRepository()); err != nil {
+			return imageComparison{}, err
+		}
+	}
+
+	return comparison, nil
+}
+
+func (c imageComparison) upToDate(reference string) bool {
+	current, found := c.target[reference]
+	return found && current.digest == c.source[reference].digest
+}
+
+func (e *ECR) reconcile(target *ECR, data metadataList, policy conflictPolicy, force bool) (metadataList, error) {
+	counter, skipped := 0, 0
+	for i := range data.repoList {
+		metadata := &data.repoList[i]
+		comparison, err := e.compareImages(target, *metadata)
+		if err != nil {
+			return metadataList{}, fmt.Errorf("comparing images of %s: %w", metadata.repositoryName, err)
+		}
+
+		var tags, digests, upToDate []string
+		for _, reference := range slices.Concat(metadata.tags, metadata.digests) {
+			if comparison.upToDate(reference) && !force {
+				slog.Info("ecrCompare", "repository", metadata.repositoryName, "reference", reference, "status", "up to date")
+				upToDate = append(upToDate, reference)
+				continue
+			}
+
+			c, migrate := policy.resolve(metadata, comparison, reference)
+			if c.repository != "" {
+				data.conflicts = append(data.conflicts, c)
+			}
+			if !migrate {
+				skipped++
+				continue
+			}
+
+			if strings.HasPrefix(reference, "sha256:") {
+				digests = append(digests, reference)
+			} else {
+				tags = append(tags, reference)
+			}
+		}
+
+		metadata.tags = tags
+		metadata.digests = digests
+		metadata.upToDate = upToDate
+		metadata.images = comparison.source
+		counter += len(upToDate)
+	}
+
+	data.imagesCount -= counter + skipped
+	slog.Info("ecrCompare", "images", data.imagesCount, "upToDate", counter, "conflicts", len(data.conflicts))
+	return data, nil
 }
 
 func (e *ECR) exists(repository string) bool {
@@ -161,32 +451,61 @@ func (e *ECR) exists(repository string) bool {
 }
 
 func (e *ECR) create(repository, policy string) error {
-	_, err := e.ecr.CreateRepository(e.ctx, &ecr.CreateRepositoryInput{
-		RepositoryName: aws.String(repository),
-	})
+	metadata := repositoryMetadata{repositoryName: repository, repositoryPolicy: policy}
+	if err := e.createRepository(metadata); err != nil {
+		return err
+	}
+	return e.applyPolicy(metadata)
+}
+
+func (e *ECR) createRepository(metadata repositoryMetadata) error {
+	_, err := e.ecr.CreateRepository(e.ctx, e.createInput(metadata))
+	if err != nil {
+		slog.Error("ecrCreate", "repositoryName", metadata.targetRepository(), "error", err)
+		return err
+	}
+	slog.Info("ecrCreate", "repositoryName", metadata.targetRepository(), "status", "created")
+	return nil
+}
+
+func (e *ECR) applyPolicy(metadata repositoryMetadata) error {
+	repository := metadata.targetRepository()
+	policy, err := e.policyRewrite.rewrite(repository, metadata.repositoryPolicy)
 	if err != nil {
-		slog.Error("ecrCreate", "error", err)
 		return err
 	}
-	slog.Info("ecrCreate", "repositoryName", repository, "status", "created")
 	return e.setPolicy(repository, policy)
 }
 
-func (e *ECR) validate(metadata metadataList) []string {
-	repositoryList := make([]string, len(metadata.repoList))
-	for i, metadata := range metadata.repoList {
-		repositoryList[i] = metadata.repositoryName
-		if !e.exists(metadata.repositoryName) {
-			if err := e.create(metadata.repositoryName, metadata.repositoryPolicy); err != nil {
-				slog.Error("ecr", "error", err)
+func (e *ECR) validate(data metadataList) ([]string, map[string]error) {
+	var repositoryList []string
+	failed := make(map[string]error)
+	for _, metadata := range data.repoList {
+		created := !e.exists(metadata.targetRepository())
+		if created {
+			if err := e.createRepository(metadata); err != nil {
+				failed[metadata.repositoryName] = err
 				continue
 			}
+			if err := e.applyPolicy(metadata); err != nil {
+				slog.Error("setPolicy", "repository", metadata.targetRepository(), "error", err)
+			}
 		} else {
-			slog.Info("ecrCreate", "repository", metadata.repositoryName, "status", "already exists")
+			slog.Info("ecrCreate", "repository", metadata.targetRepository(), "status", "already exists")
+			if e.reconcileExisting {
+				if err := e.reconcileSettings(metadata); err != nil {
+					slog.Error("reconcileSettings", "repository", metadata.targetRepository(), "error", err)
+				}
+			}
+		}
+		repositoryList = append(repositoryList, metadata.targetRepository())
+
+		if err := e.setLifecyclePolicy(metadata, created); err != nil {
+			slog.Error("setLifecyclePolicy", "repository", metadata.targetRepository(), "error", err)
 		}
 	}
 
-	return repositoryList
+	return repositoryList, failed
 }
 
 func (e *ECR) setPolicy(repositoryName, repositoryPolicy string) error {
@@ -199,3 +518,18 @@ func (e *ECR) setPolicy(repositoryName, repositoryPolicy string) error {
 	}
 	return err
 }
+
+func (e *ECR) prepare(data metadataList) (authorization, map[string]repositoryMetadata, map[string]error, error) {
+	repositories, failed := e.validate(data)
+	targetRepositoriesMetadata, err := e.getRepositoryURIs(repositories)
+	if err != nil {
+		return authorization{}, nil, nil, err
+	}
+
+	token, err := e.authenticate()
+	if err != nil {
+		return authorization{}, nil, nil, authErr(err)
+	}
+
+	return token, targetRepositoriesMetadata, failed, nil
+}
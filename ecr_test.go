@@ -66,7 +66,10 @@ func TestWalk(t *testing.T) {
 	}
 
 	repoFinder := newRepositoryFinder()
-	repositories := repoFinder.locateIn(fileName).registryList()
+	repositories, err := repoFinder.locateIn(fileName).registryList()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	awsFrom := mustInitConfig(
 		withRegion(ecrConfig.fromRegion),
@@ -87,7 +90,7 @@ func TestWalk(t *testing.T) {
 		}
 	}
 
-	imageMetadataList := ecrRegistry.walk(repositories.List)
+	imageMetadataList := mustWalk(t, ecrRegistry, repositories.List)
 
 	assert.Len(t, imageMetadataList.repoList, expected.RepoListLen, "expected list length %d but got %d", expected.RepoListLen, len(imageMetadataList.repoList))
 	assert.Equal(t, expected.UserName, imageMetadataList.auth.username, "expected username %s but got %s", expected.UserName, imageMetadataList.auth.username)
@@ -102,3 +105,87 @@ func TestWalk(t *testing.T) {
 
 	delete(svcFrom.ecr, repositories.List)
 }
+
+func TestWalkPagination(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	tags := []string{"1.0", "1.1", "1.2", "1.3", "1.4"}
+	for _, tag := range tags {
+		registry.addImage("repo/test/app1", []string{tag}, []byte("layer-"+tag))
+	}
+	registry.addImage("repo/test/app2", []string{"2.0"}, []byte("layer-2.0"))
+
+	imageMetadataList := mustWalk(t, registry.client(), []string{"repo/test/app1", "repo/test/app2"})
+
+	assert.Len(t, imageMetadataList.repoList, 2)
+	assert.Equal(t, tags, imageMetadataList.repoList[0].tags)
+	assert.Equal(t, []string{"2.0"}, imageMetadataList.repoList[1].tags)
+	assert.Equal(t, 6, imageMetadataList.imagesCount)
+	assert.Equal(t, 4, registry.calls["ListImages"], "expected three pages for app1 and one for app2")
+}
+
+func TestWalkListImagesFailure(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	registry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	registry.errors["ListImages"] = "ServerException"
+
+	_, err := registry.client().walk([]string{"repo/test/app1"})
+	assert.ErrorContains(t, err, "repo/test/app1")
+
+	registry.errors["DescribeRepositories"] = "AccessDeniedException"
+	_, err = registry.client().walk([]string{"repo/test/app1"})
+	assert.Equal(t, exitAuthError, exitCode(err))
+}
+
+func TestChunk(t *testing.T) {
+	assert.Empty(t, chunk(nil, 100))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, chunk([]string{"a", "b", "c", "d", "e"}, 2))
+	assert.Equal(t, [][]string{{"a", "b"}}, chunk([]string{"a", "b"}, 2))
+}
+
+func TestWalkUntagged(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	registry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	untagged := registry.addImage("repo/test/app1", nil, []byte("layer-untagged"))
+
+	tagged := mustWalk(t, registry.client(), []string{"repo/test/app1"})
+	assert.Equal(t, []string{"1.0"}, tagged.repoList[0].tags)
+	assert.Empty(t, tagged.repoList[0].digests)
+	assert.Equal(t, 1, tagged.imagesCount)
+
+	all := mustWalk(t, registry.client().withUntagged(true), []string{"repo/test/app1"})
+	assert.Equal(t, []string{"1.0"}, all.repoList[0].tags)
+	assert.Equal(t, []string{untagged.digest}, all.repoList[0].digests)
+	assert.Equal(t, 2, all.imagesCount)
+}
+
+func TestSkipUpToDate(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	sourceRegistry.addImage("repo/test/app1", []string{"1.1"}, []byte("layer-1.1"))
+	sourceRegistry.addImage("repo/test/app1", []string{"1.2"}, []byte("layer-1.2"))
+	sourceRegistry.addImage("repo/test/app2", []string{"2.0"}, []byte("layer-2.0"))
+
+	targetRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	targetRegistry.addImage("repo/test/app1", []string{"1.1"}, []byte("layer-1.1-changed"))
+
+	source := sourceRegistry.client()
+	policy := newConflictPolicy(conflictOverwrite, "", nil)
+	metadata := mustReconcile(t, source, targetRegistry.client(), mustWalk(t, source, []string{"repo/test/app1", "repo/test/app2"}), policy)
+
+	assert.Equal(t, []string{"1.1", "1.2"}, metadata.repoList[0].tags)
+	assert.Equal(t, []string{"1.0"}, metadata.repoList[0].upToDate)
+	assert.Equal(t, []string{"2.0"}, metadata.repoList[1].tags)
+	assert.Empty(t, metadata.repoList[1].upToDate)
+	assert.Equal(t, 3, metadata.imagesCount)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type ECRCopy struct {
+	http      *http.Client
+	source    *ECR
+	target    *ECR
+	platforms []ocispec.Platform
+}
+
+func newEcrCopy(source, target *ECR) *ECRCopy {
+	return &ECRCopy{
+		http:   http.DefaultClient,
+		source: source,
+		target: target,
+	}
+}
+
+func (c *ECRCopy) withPlatforms(platforms []ocispec.Platform) *ECRCopy {
+	c.platforms = platforms
+	return c
+}
+
+func (c *ECRCopy) copy(image copyImage) (string, error) {
+	from, err := parseImageReference(image.from)
+	if err != nil {
+		return "", err
+	}
+
+	to, err := parseImageReference(image.to)
+	if err != nil {
+		return "", err
+	}
+
+	return copyManifest(c, from, to, c.platforms)
+}
+
+func (c *ECRCopy) getManifest(reference imageReference) (manifest, error) {
+	return c.source.getImageManifest(reference.repository, reference.reference)
+}
+
+func (c *ECRCopy) putManifest(reference imageReference, m manifest) (string, error) {
+	return c.target.putImage(reference.repository, reference.reference, m)
+}
+
+func (c *ECRCopy) copyBlobs(from, to imageReference, blobs []ocispec.Descriptor) error {
+	layers := make([]string, len(blobs))
+	for i, desc := range blobs {
+		layers[i] = desc.Digest.String()
+	}
+
+	missing, err := c.target.unavailableLayers(to.repository, layers)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("layerCopy", "repository", to.repository, "layers", len(layers), "missing", len(missing))
+	for _, layer := range missing {
+		if err := c.copyLayer(from.repository, to.repository, layer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *ECRCopy) copyLayer(fromRepository, toRepository, layerDigest string) error {
+	downloadURL, err := c.source.layerDownloadURL(fromRepository, layerDigest)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(c.source.ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading layer %s from %s: status %d", layerDigest, fromRepository, resp.StatusCode)
+	}
+
+	if err := c.target.uploadLayer(toRepository, layerDigest, resp.Body); err != nil {
+		return err
+	}
+
+	slog.Info("layerCopy", "repository", toRepository, "digest", layerDigest, "status", "copied")
+	return nil
+}
+
+func imageIdentifier(reference string) types.ImageIdentifier {
+	if strings.HasPrefix(reference, "sha256:") {
+		return types.ImageIdentifier{ImageDigest: aws.String(reference)}
+	}
+	return types.ImageIdentifier{ImageTag: aws.String(reference)}
+}
+
+func (e *ECR) getImageManifest(repository, reference string) (manifest, error) {
+	resp, err := e.ecr.BatchGetImage(e.ctx, &ecr.BatchGetImageInput{
+		RepositoryName:     aws.String(repository),
+		ImageIds:           []types.ImageIdentifier{imageIdentifier(reference)},
+		AcceptedMediaTypes: manifestMediaTypes,
+	})
+	if err != nil {
+		return manifest{}, err
+	}
+
+	if len(resp.Images) == 0 {
+		if len(resp.Failures) > 0 {
+			return manifest{}, fmt.Errorf("getting image %s:%s: %s", repository, reference, aws.ToString(resp.Failures[0].FailureReason))
+		}
+		return manifest{}, fmt.Errorf("image %s:%s not found", repository, reference)
+	}
+
+	image := resp.Images[0]
+	return newManifest(
+		[]byte(aws.ToString(image.ImageManifest)),
+		aws.ToString(image.ImageManifestMediaType),
+		aws.ToString(image.ImageId.ImageDigest),
+	), nil
+}
+
+func (e *ECR) unavailableLayers(repository string, layers []string) ([]string, error) {
+	resp, err := e.ecr.BatchCheckLayerAvailability(e.ctx, &ecr.BatchCheckLayerAvailabilityInput{
+		RepositoryName: aws.String(repository),
+		LayerDigests:   layers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	available := make(map[string]bool, len(resp.Layers))
+	for _, layer := range resp.Layers {
+		available[aws.ToString(layer.LayerDigest)] = layer.LayerAvailability == types.LayerAvailabilityAvailable
+	}
+
+	missing := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		if !available[layer] {
+			missing = append(missing, layer)
+		}
+	}
+
+	return missing, nil
+}
+
+func (e *ECR) layerDownloadURL(repository, layerDigest string) (string, error) {
+	resp, err := e.ecr.GetDownloadUrlForLayer(e.ctx, &ecr.GetDownloadUrlForLayerInput{
+		RepositoryName: aws.String(repository),
+		LayerDigest:    aws.String(layerDigest),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(resp.DownloadUrl), nil
+}
+
+func (e *ECR) uploadLayer(repository, layerDigest string, layer io.Reader) error {
+	upload, err := e.ecr.InitiateLayerUpload(e.ctx, &ecr.InitiateLayerUploadInput{
+		RepositoryName: aws.String(repository),
+	})
+	if err != nil {
+		return err
+	}
+
+	partSize := aws.ToInt64(upload.PartSize)
+	if partSize <= 0 {
+		return fmt.Errorf("invalid part size %d for layer upload in %s", partSize, repository)
+	}
+
+	buf := make([]byte, partSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(layer, buf)
+		if n > 0 {
+			_, uploadErr := e.ecr.UploadLayerPart(e.ctx, &ecr.UploadLayerPartInput{
+				RepositoryName: aws.String(repository),
+				UploadId:       upload.UploadId,
+				PartFirstByte:  aws.Int64(offset),
+				PartLastByte:   aws.Int64(offset + int64(n) - 1),
+				LayerPartBlob:  buf[:n],
+			})
+			if uploadErr != nil {
+				return uploadErr
+			}
+			offset += int64(n)
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = e.ecr.CompleteLayerUpload(e.ctx, &ecr.CompleteLayerUploadInput{
+		RepositoryName: aws.String(repository),
+		UploadId:       upload.UploadId,
+		LayerDigests:   []string{layerDigest},
+	})
+	if err != nil {
+		var alreadyExistsErr *types.LayerAlreadyExistsException
+		if errors.As(err, &alreadyExistsErr) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (e *ECR) putImage(repository, reference string, m manifest) (string, error) {
+	input := &ecr.PutImageInput{
+		RepositoryName:         aws.String(repository),
+		ImageManifest:          aws.String(string(m.raw)),
+		ImageManifestMediaType: aws.String(m.mediaType),
+	}
+
+	if strings.HasPrefix(reference, "sha256:") {
+		input.ImageDigest = aws.String(reference)
+	} else {
+		input.ImageTag = aws.String(reference)
+	}
+
+	resp, err := e.ecr.PutImage(e.ctx, input)
+	if err != nil {
+		var alreadyExistsErr *types.ImageAlreadyExistsException
+		if errors.As(err, &alreadyExistsErr) {
+			slog.Info("putImage", "repository", repository, "reference", reference, "status", "already exists")
+			return m.digest, nil
+		}
+		return "", err
+	}
+
+	if resp.Image == nil || resp.Image.ImageId == nil {
+		return "", nil
+	}
+	return aws.ToString(resp.Image.ImageId.ImageDigest), nil
+}
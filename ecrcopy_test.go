@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECRCopy(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceImage := sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1"), []byte("layer-2"))
+	targetRegistry.addImage("repo/test/app1", []string{"0.9"}, []byte("layer-1"))
+
+	ecrCopy := newEcrCopy(sourceRegistry.client(), targetRegistry.client())
+	ecrCopy.http = sourceRegistry.server.Client()
+
+	_, err := ecrCopy.copy(copyImage{
+		from: sourceRegistry.host + "/repo/test/app1:1.0",
+		to:   targetRegistry.host + "/repo/test/app1:1.0",
+	})
+	assert.NoError(t, err)
+
+	targetImage := targetRegistry.image("repo/test/app1", "1.0")
+	if assert.NotNil(t, targetImage, "expected image to be pushed to the target") {
+		assert.Equal(t, sourceImage.digest, targetImage.digest)
+		assert.Equal(t, sourceImage.manifest, targetImage.manifest)
+	}
+	assert.Equal(t, 1, targetRegistry.layerUploads, "expected only the missing layer to be uploaded")
+}
+
+func TestECRCopyImageNotFound(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	ecrCopy := newEcrCopy(registry.client(), registry.client())
+	_, err := ecrCopy.copy(copyImage{
+		from: registry.host + "/repo/test/app1:missing",
+		to:   registry.host + "/repo/test/app2:missing",
+	})
+	assert.Error(t, err)
+}
+
+func TestECRCopyByDigest(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceImage := sourceRegistry.addImage("repo/test/app1", nil, []byte("layer"))
+
+	from, to := generateECRImageNames(
+		map[string]repositoryMetadata{"repo/test/app1": {repositoryURI: targetRegistry.host + "/repo/test/app1"}},
+		"repo/test/app1",
+		sourceRegistry.host+"/repo/test/app1",
+		sourceImage.digest,
+		sourceImage.digest,
+	)
+	assert.Equal(t, targetRegistry.host+"/repo/test/app1@"+sourceImage.digest, to)
+
+	ecrCopy := newEcrCopy(sourceRegistry.client(), targetRegistry.client())
+	ecrCopy.http = sourceRegistry.server.Client()
+
+	digest, err := ecrCopy.copy(copyImage{from: from, to: to})
+	assert.NoError(t, err)
+	assert.Equal(t, sourceImage.digest, digest)
+
+	targetImage := targetRegistry.image("repo/test/app1", sourceImage.digest)
+	if assert.NotNil(t, targetImage, "expected untagged image to be pushed by digest") {
+		assert.Empty(t, targetImage.tags)
+	}
+}
+
+func TestECRCopyIndex(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceIndex := sourceRegistry.addIndex("repo/test/app1", []string{"1.0"},
+		ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		ocispec.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	ecrCopy := newEcrCopy(sourceRegistry.client(), targetRegistry.client())
+	ecrCopy.http = sourceRegistry.server.Client()
+
+	_, err := ecrCopy.copy(copyImage{
+		from: sourceRegistry.host + "/repo/test/app1:1.0",
+		to:   targetRegistry.host + "/repo/test/app1:1.0",
+	})
+	assert.NoError(t, err)
+
+	targetIndex := targetRegistry.image("repo/test/app1", "1.0")
+	if assert.NotNil(t, targetIndex) {
+		assert.Equal(t, sourceIndex.digest, targetIndex.digest)
+		assert.Equal(t, ocispec.MediaTypeImageIndex, targetIndex.mediaType)
+	}
+	assert.Len(t, targetRegistry.repository("repo/test/app1").images, 3)
+}
+
+func TestECRCopyFilteredUntaggedIndex(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceIndex := sourceRegistry.addIndex("repo/test/app1", nil,
+		ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		ocispec.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	ecrCopy := newEcrCopy(sourceRegistry.client(), targetRegistry.client()).withPlatforms([]ocispec.Platform{{OS: "linux", Architecture: "arm64"}})
+	ecrCopy.http = sourceRegistry.server.Client()
+
+	pushed, err := ecrCopy.copy(copyImage{
+		from: sourceRegistry.host + "/repo/test/app1@" + sourceIndex.digest,
+		to:   targetRegistry.host + "/repo/test/app1@" + sourceIndex.digest,
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, sourceIndex.digest, pushed, "expected the filtered index to be pushed by its own digest")
+	assert.NotNil(t, targetRegistry.image("repo/test/app1", pushed))
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/aws/smithy-go"
+)
+
+const (
+	exitOK            = 0
+	exitError         = 1
+	exitConfigError   = 2
+	exitAuthError     = 3
+	exitPartialFailed = 4
+	exitFailed        = 5
+	exitInterrupted   = 130
+)
+
+var accessDeniedCodes = []string{
+	"AccessDenied",
+	"AccessDeniedException",
+	"UnauthorizedOperation",
+}
+
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return "config: " + e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+func configErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &configError{err: err}
+}
+
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string {
+	return "auth: " + e.err.Error()
+}
+
+func (e *authError) Unwrap() error {
+	return e.err
+}
+
+func authErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &authError{err: err}
+}
+
+type interruptedError struct {
+	err error
+}
+
+func (e *interruptedError) Error() string {
+	if e.err == nil {
+		return "interrupted"
+	}
+	return "interrupted: " + e.err.Error()
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+type imageFailure struct {
+	repository string
+	reference  string
+	err        error
+}
+
+type migrationError struct {
+	unit     string
+	total    int
+	failures []imageFailure
+}
+
+func (e *migrationError) Error() string {
+	unit := e.unit
+	if unit == "" {
+		unit = "images"
+	}
+	return fmt.Sprintf("%d of %d %s failed", len(e.failures), e.total, unit)
+}
+
+func (e *migrationError) denied() bool {
+	for _, failure := range e.failures {
+		if accessDenied(failure.err) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *migrationError) partial() bool {
+	return len(e.failures) < e.total
+}
+
+type failureList struct {
+	mu        sync.Mutex
+	total     int
+	cancelled int
+	failures  []imageFailure
+}
+
+func (f *failureList) attempt() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.total++
+}
+
+func (f *failureList) add(repository, reference string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, imageFailure{repository: repository, reference: reference, err: err})
+}
+
+func (f *failureList) addRepository(repository string, references []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, reference := range references {
+		f.total++
+		f.failures = append(f.failures, imageFailure{repository: repository, reference: reference, err: err})
+	}
+}
+
+func (f *failureList) cancel(repository, reference string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled++
+	slog.Warn("imageCancelled", "repository", repository, "reference", reference, "status", "not started, shutting down")
+}
+
+func (f *failureList) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancelled > 0 {
+		slog.Warn("imageCancelled", "images", f.cancelled, "status", "run again with --resume to migrate them")
+	}
+
+	if len(f.failures) == 0 {
+		return nil
+	}
+
+	for _, failure := range f.failures {
+		slog.Error("imageFailure", "repository", failure.repository, "reference", failure.reference, "error", failure.err)
+	}
+	return &migrationError{total: f.total, failures: f.failures}
+}
+
+func accessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && slices.Contains(accessDeniedCodes, apiErr.ErrorCode())
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var (
+		interrupted *interruptedError
+		config      *configError
+		auth        *authError
+		migration   *migrationError
+	)
+
+	switch {
+	case errors.As(err, &interrupted):
+		return exitInterrupted
+	case errors.As(err, &config):
+		return exitConfigError
+	case errors.As(err, &auth), accessDenied(err):
+		return exitAuthError
+	case errors.As(err, &migration):
+		if migration.denied() {
+			return exitAuthError
+		}
+		if migration.partial() {
+			return exitPartialFailed
+		}
+		return exitFailed
+	}
+	return exitError
+}
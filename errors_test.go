@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitError, exitCode(errors.New("boom")))
+	assert.Equal(t, exitConfigError, exitCode(configErr(errors.New("bad yaml"))))
+	assert.Equal(t, exitAuthError, exitCode(fmt.Errorf("walking: %w", authErr(errors.New("expired token")))))
+	assert.Equal(t, exitAuthError, exitCode(fmt.Errorf("describing repositories: %w", &smithy.GenericAPIError{Code: "AccessDeniedException"})))
+	assert.Equal(t, exitAuthError, exitCode(&migrationError{total: 2, failures: []imageFailure{{err: &smithy.GenericAPIError{Code: "AccessDeniedException"}}}}))
+	assert.Equal(t, exitPartialFailed, exitCode(&migrationError{total: 2, failures: []imageFailure{{}}}))
+	assert.Equal(t, exitFailed, exitCode(&migrationError{total: 1, failures: []imageFailure{{}}}))
+	assert.Equal(t, exitInterrupted, exitCode(&interruptedError{err: &migrationError{total: 2, failures: []imageFailure{{}}}}))
+
+	assert.Nil(t, configErr(nil))
+	assert.Nil(t, authErr(nil))
+}
+
+func TestTransferFailures(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-shared"))
+	sourceRegistry.addImage("repo/test/app1", []string{"2.0"}, []byte("layer-new"))
+	targetRegistry.addImage("repo/test/app1", []string{"0.9"}, []byte("layer-shared"))
+
+	metadata := mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1"})
+
+	err := newTransfer().
+		withSource(sourceRegistry.client()).
+		withTarget(targetRegistry.client()).
+		addMetadataList(metadata).
+		withArgs(&Args{engine: engineECR, copiers: 1}).
+		migrate()
+
+	var migrationErr *migrationError
+	if assert.ErrorAs(t, err, &migrationErr) {
+		assert.Equal(t, 2, migrationErr.total)
+		if assert.Len(t, migrationErr.failures, 1, "expected the image needing a layer download to fail") {
+			assert.Equal(t, "2.0", migrationErr.failures[0].reference)
+		}
+	}
+	assert.Equal(t, exitPartialFailed, exitCode(err))
+	assert.NotNil(t, targetRegistry.image("repo/test/app1", "1.0"))
+}
+
+func TestTransferCreateFailures(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-shared"))
+	sourceRegistry.addImage("repo/test/app2", []string{"1.0", "latest"}, []byte("layer-shared"))
+	targetRegistry.addImage("repo/test/app1", []string{"0.9"}, []byte("layer-shared"))
+	targetRegistry.errors["CreateRepository"] = "LimitExceededException"
+
+	metadata := mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1", "repo/test/app2"})
+
+	report := newMigrationReport()
+	err := newTransfer().
+		withSource(sourceRegistry.client()).
+		withTarget(targetRegistry.client()).
+		withReport(report).
+		addMetadataList(metadata).
+		withArgs(&Args{engine: engineECR, copiers: 1}).
+		migrate()
+
+	var migrationErr *migrationError
+	if assert.ErrorAs(t, err, &migrationErr) {
+		assert.Equal(t, 3, migrationErr.total)
+		if assert.Len(t, migrationErr.failures, 2, "expected both images of the repository that could not be created to fail") {
+			assert.Equal(t, "repo/test/app2", migrationErr.failures[0].repository)
+		}
+	}
+	assert.Equal(t, exitPartialFailed, exitCode(err))
+	assert.NotNil(t, targetRegistry.image("repo/test/app1", "1.0"))
+	assert.Equal(t, map[string]int{outcomeCopied: 1, outcomeFailed: 2}, report.document().Summary)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+type tagFilter struct {
+	Include      []string  `yaml:"include"`
+	IncludeRegex []string  `yaml:"include_regex"`
+	Exclude      []string  `yaml:"exclude"`
+	ExcludeRegex []string  `yaml:"exclude_regex"`
+	Semver       string    `yaml:"semver"`
+	Latest       int       `yaml:"latest"`
+	PushedAfter  time.Time `yaml:"pushed_after"`
+	PushedBefore time.Time `yaml:"pushed_before"`
+}
+
+type compiledFilter struct {
+	include      []string
+	includeRegex []*regexp.Regexp
+	exclude      []string
+	excludeRegex []*regexp.Regexp
+	semver       *semver.Constraints
+	latest       int
+	pushedAfter  time.Time
+	pushedBefore time.Time
+}
+
+func (f *tagFilter) compile() (*compiledFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	c := &compiledFilter{
+		include:      f.Include,
+		exclude:      f.Exclude,
+		latest:       f.Latest,
+		pushedAfter:  f.PushedAfter,
+		pushedBefore: f.PushedBefore,
+	}
+
+	for _, pattern := range append(f.Include, f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %q: %w", pattern, err)
+		}
+	}
+
+	var err error
+	if c.includeRegex, err = compileRegexps(f.IncludeRegex); err != nil {
+		return nil, err
+	}
+	if c.excludeRegex, err = compileRegexps(f.ExcludeRegex); err != nil {
+		return nil, err
+	}
+
+	if f.Semver != "" {
+		if c.semver, err = semver.NewConstraint(f.Semver); err != nil {
+			return nil, fmt.Errorf("invalid semver range %q: %w", f.Semver, err)
+		}
+	}
+
+	if f.Latest < 0 {
+		return nil, fmt.Errorf("invalid latest value %d", f.Latest)
+	}
+
+	return c, nil
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	list := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag regex %q: %w", pattern, err)
+		}
+		list[i] = re
+	}
+	return list, nil
+}
+
+func (c *compiledFilter) needsDetails() bool {
+	return c.latest > 0 || !c.pushedAfter.IsZero() || !c.pushedBefore.IsZero()
+}
+
+func matchAny(tag string, patterns []string, regexps []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, tag); matched {
+			return true
+		}
+	}
+	for _, re := range regexps {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledFilter) match(tag string, details map[string]imageDetail) bool {
+	if (len(c.include) > 0 || len(c.includeRegex) > 0) && !matchAny(tag, c.include, c.includeRegex) {
+		return false
+	}
+
+	if matchAny(tag, c.exclude, c.excludeRegex) {
+		return false
+	}
+
+	if c.semver != nil {
+		version, err := semver.NewVersion(tag)
+		if err != nil || !c.semver.Check(version) {
+			return false
+		}
+	}
+
+	pushedAt := details[tag].pushedAt
+	if !c.pushedAfter.IsZero() && !pushedAt.After(c.pushedAfter) {
+		return false
+	}
+	if !c.pushedBefore.IsZero() && !pushedAt.Before(c.pushedBefore) {
+		return false
+	}
+
+	return true
+}
+
+func (c *compiledFilter) apply(tags []string, details map[string]imageDetail) []string {
+	selected := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if c.match(tag, details) {
+			selected = append(selected, tag)
+		}
+	}
+
+	if c.latest == 0 || len(selected) <= c.latest {
+		return selected
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return details[selected[i]].pushedAt.After(details[selected[j]].pushedAt)
+	})
+	return selected[:c.latest]
+}
+
+type tagFilters struct {
+	global       *compiledFilter
+	repositories map[string]*compiledFilter
+}
+
+func (f tagFilters) forRepository(repository string) []*compiledFilter {
+	var filters []*compiledFilter
+	if f.global != nil {
+		filters = append(filters, f.global)
+	}
+	if filter, found := f.repositories[repository]; found && filter != nil {
+		filters = append(filters, filter)
+	}
+	return filters
+}
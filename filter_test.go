@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagFilter(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tags := []string{"1.0.0", "1.1.0", "1.2.0-rc1", "2.0.0", "latest", "ci-1234", "release-2024"}
+	details := map[string]imageDetail{
+		"1.0.0":        {pushedAt: day(1)},
+		"1.1.0":        {pushedAt: day(2)},
+		"1.2.0-rc1":    {pushedAt: day(3)},
+		"2.0.0":        {pushedAt: day(4)},
+		"latest":       {pushedAt: day(4)},
+		"ci-1234":      {pushedAt: day(5)},
+		"release-2024": {pushedAt: day(6)},
+	}
+
+	tests := []struct {
+		name     string
+		filter   tagFilter
+		expected []string
+	}{
+		{
+			name:     "glob include",
+			filter:   tagFilter{Include: []string{"1.*", "latest"}},
+			expected: []string{"1.0.0", "1.1.0", "1.2.0-rc1", "latest"},
+		},
+		{
+			name:     "glob and regex exclude",
+			filter:   tagFilter{Exclude: []string{"ci-*"}, ExcludeRegex: []string{`-rc\d+$`}},
+			expected: []string{"1.0.0", "1.1.0", "2.0.0", "latest", "release-2024"},
+		},
+		{
+			name:     "regex include",
+			filter:   tagFilter{IncludeRegex: []string{`^release-\d{4}$`}},
+			expected: []string{"release-2024"},
+		},
+		{
+			name:     "semver range",
+			filter:   tagFilter{Semver: ">=1.1.0, <3.0.0"},
+			expected: []string{"1.1.0", "2.0.0"},
+		},
+		{
+			name:     "pushed after and before",
+			filter:   tagFilter{PushedAfter: day(2), PushedBefore: day(5)},
+			expected: []string{"1.2.0-rc1", "2.0.0", "latest"},
+		},
+		{
+			name:     "latest by push date",
+			filter:   tagFilter{Latest: 2, Exclude: []string{"ci-*"}},
+			expected: []string{"release-2024", "2.0.0"},
+		},
+	}
+
+	for _, test := range tests {
+		filter, err := test.filter.compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.expected, filter.apply(tags, details), test.name)
+	}
+}
+
+func TestTagFilterInvalid(t *testing.T) {
+	invalid := []tagFilter{
+		{Include: []string{"["}},
+		{ExcludeRegex: []string{"("}},
+		{Semver: "not a range"},
+		{Latest: -1},
+	}
+
+	for _, filter := range invalid {
+		_, err := filter.compile()
+		assert.Error(t, err)
+	}
+
+	var empty *tagFilter
+	compiled, err := empty.compile()
+	assert.NoError(t, err)
+	assert.Nil(t, compiled)
+}
+
+func TestWalkFilters(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	for _, tag := range []string{"1.0.0", "1.1.0", "ci-1", "ci-2", "2.0.0"} {
+		registry.addImage("repo/test/app1", []string{tag}, []byte("layer-"+tag))
+	}
+
+	file, err := os.CreateTemp("", "file*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	config := `filters:
+  exclude: ["ci-*"]
+repositories:
+  - name: repo/test/app1
+    filters:
+      latest: 2
+      pushed_after: 2023-01-01
+`
+	if _, err := file.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	repositories, err := newRepositoryFinder().locateIn(file.Name()).registryList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := mustWalk(t, registry.client().withFilters(repositories.tagFilters()), repositories.List)
+
+	assert.Equal(t, []string{"2.0.0", "1.1.0"}, metadata.repoList[0].tags)
+	assert.Equal(t, 2, metadata.imagesCount)
+}
@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"testing"
 	"time"
 
 	"math/rand"
@@ -13,6 +23,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"gopkg.in/yaml.v2"
 )
 
@@ -56,6 +68,61 @@ func createTempYamlList() (string, []string, error) {
 	return file.Name(), repo.Repositories, nil
 }
 
+func createTempConfig(t *testing.T, config string) *Repositories {
+	file, err := os.CreateTemp("", "file*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(file.Name()) })
+
+	if _, err := file.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	repositories, err := newRepositoryFinder().locateIn(file.Name()).registryList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repositories
+}
+
+func mustWalk(t *testing.T, e *ECR, repoList []string) metadataList {
+	t.Helper()
+
+	metadata, err := e.walk(repoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata
+}
+
+func mustReconcile(t *testing.T, source, target *ECR, data metadataList, policy conflictPolicy) metadataList {
+	t.Helper()
+
+	metadata, err := source.reconcile(target, data, policy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata
+}
+
+func mustInitConfig(opts ...Option) *CloudConfig {
+	c, err := initConfig(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (d *Docker) mustStartCli() *Docker {
+	d, err := d.startCli()
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
 func ecrClients(ecrConfig ecrConfigs) (*ResoureceConfig, *ResoureceConfig) {
 	awsFrom := mustInitConfig(
 		withRegion(ecrConfig.fromRegion),
@@ -127,3 +194,741 @@ func generateConfigs(repositories []string, uriImages map[string]string) []ecrIm
 func generateTargetImageName(uri, tag string) string {
 	return fmt.Sprintf("%s:%s", uri, tag)
 }
+
+type fakeRegistry struct {
+	mu        sync.Mutex
+	auth      authorization
+	blobs     map[string][]byte
+	manifests map[string]manifest
+	uploads   int
+	denied    string
+}
+
+func newFakeRegistry(auth authorization) (*fakeRegistry, *httptest.Server) {
+	r := &fakeRegistry{
+		auth:      auth,
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]manifest),
+	}
+	return r, httptest.NewTLSServer(r)
+}
+
+func (r *fakeRegistry) addBlob(b []byte) ocispec.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := digest.FromBytes(b)
+	r.blobs[d.String()] = b
+	return ocispec.Descriptor{Digest: d, Size: int64(len(b))}
+}
+
+func (r *fakeRegistry) addManifest(repository, reference, mediaType string, v any) (manifest, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return manifest{}, err
+	}
+
+	m := manifest{raw: raw, mediaType: mediaType, digest: digest.FromBytes(raw).String()}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifests[repository+":"+reference] = m
+	r.manifests[repository+"@"+m.digest] = m
+	return m, nil
+}
+
+func (r *fakeRegistry) addImage(repository, tag string, layers ...[]byte) (manifest, error) {
+	image := ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    r.addBlob([]byte(`{"architecture":"amd64","os":"linux"}`)),
+	}
+	image.SchemaVersion = 2
+	image.Config.MediaType = ocispec.MediaTypeImageConfig
+
+	for _, layer := range layers {
+		desc := r.addBlob(layer)
+		desc.MediaType = ocispec.MediaTypeImageLayerGzip
+		image.Layers = append(image.Layers, desc)
+	}
+
+	return r.addManifest(repository, tag, ocispec.MediaTypeImageManifest, image)
+}
+
+func (r *fakeRegistry) manifest(repository, reference string) (manifest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sep := ":"
+	if strings.HasPrefix(reference, "sha256:") {
+		sep = "@"
+	}
+	m, found := r.manifests[repository+sep+reference]
+	return m, found
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if username, password, ok := req.BasicAuth(); !ok || username != r.auth.username || password != r.auth.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		if r.denied != "" {
+			fmt.Fprintf(w, `{"errors":[{"code":"DENIED","message":%q}]}`, r.denied)
+		}
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		r.serveUpload(w, req, path)
+	case strings.Contains(path, "/blobs/"):
+		r.serveBlob(w, req, path[strings.LastIndex(path, "/blobs/")+len("/blobs/"):])
+	case strings.Contains(path, "/manifests/"):
+		repository, reference, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repository, reference)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *fakeRegistry) serveBlob(w http.ResponseWriter, req *http.Request, d string) {
+	r.mu.Lock()
+	b, found := r.blobs[d]
+	r.mu.Unlock()
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Header().Set("Docker-Content-Digest", d)
+	if req.Method == http.MethodGet {
+		w.Write(b)
+	}
+}
+
+func (r *fakeRegistry) serveUpload(w http.ResponseWriter, req *http.Request, path string) {
+	switch req.Method {
+	case http.MethodPost:
+		r.mu.Lock()
+		r.uploads++
+		id := r.uploads
+		r.mu.Unlock()
+
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s%d", path, id))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		d := req.URL.Query().Get("digest")
+		if digest.FromBytes(b).String() != d {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.mu.Lock()
+		r.blobs[d] = b
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *fakeRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m, found := r.manifest(repository, reference)
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", m.digest)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.raw)))
+		if req.Method == http.MethodGet {
+			w.Write(m.raw)
+		}
+	case http.MethodPut:
+		raw, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		m := manifest{raw: raw, mediaType: req.Header.Get("Content-Type"), digest: digest.FromBytes(raw).String()}
+
+		r.mu.Lock()
+		if !strings.HasPrefix(reference, "sha256:") {
+			r.manifests[repository+":"+reference] = m
+		}
+		r.manifests[repository+"@"+m.digest] = m
+		r.mu.Unlock()
+
+		w.Header().Set("Docker-Content-Digest", m.digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type fakeEcrImage struct {
+	tags      []string
+	digest    string
+	manifest  string
+	mediaType string
+	size      int64
+	pushedAt  time.Time
+}
+
+type fakeEcrRepository struct {
+	name            string
+	uri             string
+	images          []*fakeEcrImage
+	layers          map[string][]byte
+	lifecyclePolicy string
+	tagMutability   string
+	scanOnPush      bool
+	encryptionType  string
+	kmsKey          string
+	resourceTags    map[string]string
+}
+
+func (r *fakeEcrRepository) arn() string {
+	account, _, _ := strings.Cut(r.uri, ".")
+	return "arn:aws:ecr:us-east-1:" + account + ":repository/" + r.name
+}
+
+func (r *fakeEcrRepository) describe() map[string]any {
+	repository := map[string]any{
+		"repositoryName":             r.name,
+		"repositoryUri":              r.uri,
+		"repositoryArn":              r.arn(),
+		"imageTagMutability":         r.tagMutability,
+		"imageScanningConfiguration": map[string]bool{"scanOnPush": r.scanOnPush},
+	}
+	if r.encryptionType != "" {
+		repository["encryptionConfiguration"] = map[string]string{"encryptionType": r.encryptionType, "kmsKey": r.kmsKey}
+	}
+	return repository
+}
+
+type fakeEcr struct {
+	mu           sync.Mutex
+	server       *httptest.Server
+	host         string
+	repositories map[string]*fakeEcrRepository
+	uploads      map[string][]byte
+	layerUploads int
+	pageSize     int
+	calls        map[string]int
+	throttle     map[string]int
+	errors       map[string]string
+	settings     map[string]any
+	writes       map[string][]json.RawMessage
+}
+
+func newFakeEcr(host string) *fakeEcr {
+	f := &fakeEcr{
+		host:         host,
+		repositories: make(map[string]*fakeEcrRepository),
+		uploads:      make(map[string][]byte),
+		pageSize:     2,
+		calls:        make(map[string]int),
+		throttle:     make(map[string]int),
+		errors:       make(map[string]string),
+		settings:     make(map[string]any),
+		writes:       make(map[string][]json.RawMessage),
+	}
+	f.server = httptest.NewTLSServer(f)
+	return f
+}
+
+func (f *fakeEcr) client() *ECR {
+	return newEcr(ecr.New(ecr.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(f.server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		HTTPClient:       f.server.Client(),
+		RetryMaxAttempts: 1,
+	}))
+}
+
+func (f *fakeEcr) clientWith(retryer aws.Retryer) *ECR {
+	return newEcr(ecr.New(ecr.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(f.server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   f.server.Client(),
+		Retryer:      retryer,
+	}))
+}
+
+func (f *fakeEcr) repository(name string) *fakeEcrRepository {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	repo, found := f.repositories[name]
+	if !found {
+		repo = &fakeEcrRepository{
+			name:   name,
+			uri:    f.host + "/" + name,
+			layers: make(map[string][]byte),
+		}
+		f.repositories[name] = repo
+	}
+	return repo
+}
+
+func (f *fakeEcr) addImage(repository string, tags []string, layers ...[]byte) *fakeEcrImage {
+	repo := f.repository(repository)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	image := ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+	}
+	image.SchemaVersion = 2
+	repo.layers[image.Config.Digest.String()] = config
+
+	for _, layer := range layers {
+		d := digest.FromBytes(layer)
+		repo.layers[d.String()] = layer
+		image.Layers = append(image.Layers, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageLayerGzip,
+			Digest:    d,
+			Size:      int64(len(layer)),
+		})
+	}
+
+	raw, _ := json.Marshal(image)
+	img := &fakeEcrImage{
+		tags:      tags,
+		digest:    digest.FromBytes(raw).String(),
+		manifest:  string(raw),
+		mediaType: ocispec.MediaTypeImageManifest,
+		size:      image.Config.Size,
+		pushedAt:  time.Unix(1700000000+int64(len(repo.images))*86400, 0),
+	}
+	for _, layer := range image.Layers {
+		img.size += layer.Size
+	}
+	repo.images = append(repo.images, img)
+	return img
+}
+
+func (f *fakeEcr) image(repository, reference string) *fakeEcrImage {
+	repo := f.repository(repository)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, image := range repo.images {
+		if image.digest == reference || slices.Contains(image.tags, reference) {
+			return image
+		}
+	}
+	return nil
+}
+
+func (f *fakeEcr) fail(w http.ResponseWriter, errorType, message string) {
+	w.Header().Set("X-Amzn-Errortype", errorType)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"__type": errorType, "message": message})
+}
+
+func (f *fakeEcr) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/layers" {
+		repo := f.repository(req.URL.Query().Get("repository"))
+		f.mu.Lock()
+		layer, found := repo.layers[req.URL.Query().Get("digest")]
+		f.mu.Unlock()
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(layer)
+		return
+	}
+
+	var in struct {
+		RepositoryName string `json:"repositoryName"`
+		ImageIds       []struct {
+			ImageTag    string `json:"imageTag"`
+			ImageDigest string `json:"imageDigest"`
+		} `json:"imageIds"`
+		LayerDigest            string   `json:"layerDigest"`
+		LayerDigests           []string `json:"layerDigests"`
+		UploadId               string   `json:"uploadId"`
+		PartFirstByte          int64    `json:"partFirstByte"`
+		LayerPartBlob          []byte   `json:"layerPartBlob"`
+		ImageManifest          string   `json:"imageManifest"`
+		ImageManifestMediaType string   `json:"imageManifestMediaType"`
+		ImageTag               string   `json:"imageTag"`
+		ImageDigest            string   `json:"imageDigest"`
+		RepositoryNames        []string `json:"repositoryNames"`
+		LifecyclePolicyText    string   `json:"lifecyclePolicyText"`
+		ImageTagMutability     string   `json:"imageTagMutability"`
+		ResourceArn            string   `json:"resourceArn"`
+		Tags                   []struct {
+			Key   string `json:"Key"`
+			Value string `json:"Value"`
+		} `json:"tags"`
+		ImageScanningConfiguration struct {
+			ScanOnPush bool `json:"scanOnPush"`
+		} `json:"imageScanningConfiguration"`
+		EncryptionConfiguration struct {
+			EncryptionType string `json:"encryptionType"`
+			KmsKey         string `json:"kmsKey"`
+		} `json:"encryptionConfiguration"`
+		NextToken string `json:"nextToken"`
+		Filter    struct {
+			TagStatus string `json:"tagStatus"`
+		} `json:"filter"`
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		f.fail(w, "InvalidParameterException", err.Error())
+		return
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		f.fail(w, "InvalidParameterException", err.Error())
+		return
+	}
+
+	var out any
+	operation := strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "AmazonEC2ContainerRegistry_V20150921.")
+	f.mu.Lock()
+	f.calls[operation]++
+	throttled := f.throttle[operation] > 0
+	if throttled {
+		f.throttle[operation]--
+	}
+	errorType := f.errors[operation]
+	f.mu.Unlock()
+
+	if throttled {
+		f.fail(w, "ThrottlingException", "Rate exceeded")
+		return
+	}
+	if errorType != "" {
+		f.fail(w, errorType, operation+" failed")
+		return
+	}
+
+	switch operation {
+	case "GetAuthorizationToken":
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:" + f.host))
+		out = map[string]any{"authorizationData": []map[string]any{{"authorizationToken": token, "proxyEndpoint": "https://" + f.host, "expiresAt": time.Now().Add(12 * time.Hour).Unix()}}}
+	case "DescribeRepositories":
+		repositories := []map[string]any{}
+		if len(in.RepositoryNames) == 0 {
+			f.mu.Lock()
+			names := make([]string, 0, len(f.repositories))
+			for name := range f.repositories {
+				names = append(names, name)
+			}
+			f.mu.Unlock()
+			slices.Sort(names)
+
+			start, _ := strconv.Atoi(in.NextToken)
+			end := min(start+f.pageSize, len(names))
+			for _, name := range names[start:end] {
+				repositories = append(repositories, f.repository(name).describe())
+			}
+
+			page := map[string]any{"repositories": repositories}
+			if end < len(names) {
+				page["nextToken"] = strconv.Itoa(end)
+			}
+			out = page
+			break
+		}
+
+		for _, name := range in.RepositoryNames {
+			f.mu.Lock()
+			repo, found := f.repositories[name]
+			f.mu.Unlock()
+			if !found {
+				f.fail(w, "RepositoryNotFoundException", name)
+				return
+			}
+			f.mu.Lock()
+			repositories = append(repositories, repo.describe())
+			f.mu.Unlock()
+		}
+		out = map[string]any{"repositories": repositories}
+	case "DescribeImages":
+		repo := f.repository(in.RepositoryName)
+		details := []map[string]any{}
+		f.mu.Lock()
+		for _, image := range repo.images {
+			details = append(details, map[string]any{
+				"repositoryName":   repo.name,
+				"imageDigest":      image.digest,
+				"imageTags":        image.tags,
+				"imageSizeInBytes": image.size,
+				"imagePushedAt":    image.pushedAt.Unix(),
+			})
+		}
+		f.mu.Unlock()
+
+		start, _ := strconv.Atoi(in.NextToken)
+		end := min(start+f.pageSize, len(details))
+		page := map[string]any{"imageDetails": details[start:end]}
+		if end < len(details) {
+			page["nextToken"] = strconv.Itoa(end)
+		}
+		out = page
+	case "GetRepositoryPolicy":
+		f.fail(w, "RepositoryPolicyNotFoundException", in.RepositoryName)
+		return
+	case "CreateRepository":
+		repo := f.repository(in.RepositoryName)
+		f.mu.Lock()
+		repo.tagMutability = in.ImageTagMutability
+		repo.scanOnPush = in.ImageScanningConfiguration.ScanOnPush
+		repo.encryptionType = in.EncryptionConfiguration.EncryptionType
+		repo.kmsKey = in.EncryptionConfiguration.KmsKey
+		repo.resourceTags = make(map[string]string)
+		for _, tag := range in.Tags {
+			repo.resourceTags[tag.Key] = tag.Value
+		}
+		out = map[string]any{"repository": repo.describe()}
+		f.mu.Unlock()
+	case "ListTagsForResource", "TagResource":
+		name := in.ResourceArn[strings.Index(in.ResourceArn, ":repository/")+len(":repository/"):]
+		repo := f.repository(name)
+		f.mu.Lock()
+		if repo.resourceTags == nil {
+			repo.resourceTags = make(map[string]string)
+		}
+		for _, tag := range in.Tags {
+			repo.resourceTags[tag.Key] = tag.Value
+		}
+		tags := []map[string]string{}
+		for key, value := range repo.resourceTags {
+			tags = append(tags, map[string]string{"Key": key, "Value": value})
+		}
+		f.mu.Unlock()
+		out = map[string]any{"tags": tags}
+	case "PutImageTagMutability":
+		repo := f.repository(in.RepositoryName)
+		f.mu.Lock()
+		repo.tagMutability = in.ImageTagMutability
+		f.mu.Unlock()
+		out = map[string]string{"repositoryName": repo.name, "imageTagMutability": in.ImageTagMutability}
+	case "PutImageScanningConfiguration":
+		repo := f.repository(in.RepositoryName)
+		f.mu.Lock()
+		repo.scanOnPush = in.ImageScanningConfiguration.ScanOnPush
+		f.mu.Unlock()
+		out = map[string]any{"repositoryName": repo.name, "imageScanningConfiguration": map[string]bool{"scanOnPush": repo.scanOnPush}}
+	case "GetLifecyclePolicy":
+		repo := f.repository(in.RepositoryName)
+		f.mu.Lock()
+		policy := repo.lifecyclePolicy
+		f.mu.Unlock()
+		if policy == "" {
+			f.fail(w, "LifecyclePolicyNotFoundException", in.RepositoryName)
+			return
+		}
+		out = map[string]string{"repositoryName": repo.name, "lifecyclePolicyText": policy}
+	case "PutLifecyclePolicy":
+		repo := f.repository(in.RepositoryName)
+		f.mu.Lock()
+		repo.lifecyclePolicy = in.LifecyclePolicyText
+		f.mu.Unlock()
+		out = map[string]string{"repositoryName": repo.name, "lifecyclePolicyText": in.LifecyclePolicyText}
+	case "ListImages":
+		repo := f.repository(in.RepositoryName)
+		ids := []map[string]string{}
+		f.mu.Lock()
+		for _, image := range repo.images {
+			if len(image.tags) == 0 && in.Filter.TagStatus != "TAGGED" {
+				ids = append(ids, map[string]string{"imageDigest": image.digest})
+			}
+			for _, tag := range image.tags {
+				if in.Filter.TagStatus != "UNTAGGED" {
+					ids = append(ids, map[string]string{"imageDigest": image.digest, "imageTag": tag})
+				}
+			}
+		}
+		f.mu.Unlock()
+
+		start, _ := strconv.Atoi(in.NextToken)
+		end := min(start+f.pageSize, len(ids))
+		page := map[string]any{"imageIds": ids[start:end]}
+		if end < len(ids) {
+			page["nextToken"] = strconv.Itoa(end)
+		}
+		out = page
+	case "BatchGetImage":
+		images := []map[string]any{}
+		for _, id := range in.ImageIds {
+			reference := id.ImageTag
+			if id.ImageDigest != "" {
+				reference = id.ImageDigest
+			}
+			if image := f.image(in.RepositoryName, reference); image != nil {
+				images = append(images, map[string]any{
+					"repositoryName":         in.RepositoryName,
+					"imageId":                map[string]string{"imageDigest": image.digest, "imageTag": id.ImageTag},
+					"imageManifest":          image.manifest,
+					"imageManifestMediaType": image.mediaType,
+				})
+			}
+		}
+		out = map[string]any{"images": images}
+	case "BatchCheckLayerAvailability":
+		repo := f.repository(in.RepositoryName)
+		layers := []map[string]string{}
+		f.mu.Lock()
+		for _, d := range in.LayerDigests {
+			availability := "UNAVAILABLE"
+			if _, found := repo.layers[d]; found {
+				availability = "AVAILABLE"
+			}
+			layers = append(layers, map[string]string{"layerDigest": d, "layerAvailability": availability})
+		}
+		f.mu.Unlock()
+		out = map[string]any{"layers": layers}
+	case "GetDownloadUrlForLayer":
+		query := url.Values{"repository": {in.RepositoryName}, "digest": {in.LayerDigest}}
+		out = map[string]string{"downloadUrl": f.server.URL + "/layers?" + query.Encode(), "layerDigest": in.LayerDigest}
+	case "InitiateLayerUpload":
+		f.mu.Lock()
+		f.layerUploads++
+		id := fmt.Sprintf("upload-%d", f.layerUploads)
+		f.uploads[id] = nil
+		f.mu.Unlock()
+		out = map[string]any{"uploadId": id, "partSize": 4}
+	case "UploadLayerPart":
+		f.mu.Lock()
+		if int64(len(f.uploads[in.UploadId])) != in.PartFirstByte {
+			f.mu.Unlock()
+			f.fail(w, "InvalidLayerPartException", "unexpected part offset")
+			return
+		}
+		f.uploads[in.UploadId] = append(f.uploads[in.UploadId], in.LayerPartBlob...)
+		f.mu.Unlock()
+		out = map[string]any{"uploadId": in.UploadId, "lastByteReceived": in.PartFirstByte + int64(len(in.LayerPartBlob)) - 1}
+	case "CompleteLayerUpload":
+		repo := f.repository(in.RepositoryName)
+		f.mu.Lock()
+		layer := f.uploads[in.UploadId]
+		if digest.FromBytes(layer).String() != in.LayerDigests[0] {
+			f.mu.Unlock()
+			f.fail(w, "InvalidLayerException", "digest mismatch")
+			return
+		}
+		repo.layers[in.LayerDigests[0]] = layer
+		f.mu.Unlock()
+		out = map[string]any{"uploadId": in.UploadId, "layerDigest": in.LayerDigests[0]}
+	case "PutImage":
+		repo := f.repository(in.RepositoryName)
+		d := digest.FromString(in.ImageManifest).String()
+		if in.ImageDigest != "" && in.ImageDigest != d {
+			f.fail(w, "ImageDigestDoesNotMatchException", "digest mismatch")
+			return
+		}
+		f.mu.Lock()
+		var image *fakeEcrImage
+		for _, existing := range repo.images {
+			if existing.digest == d {
+				image = existing
+			}
+		}
+		if image == nil {
+			image = &fakeEcrImage{digest: d, manifest: in.ImageManifest, mediaType: in.ImageManifestMediaType}
+			repo.images = append(repo.images, image)
+		}
+		if in.ImageTag != "" && !slices.Contains(image.tags, in.ImageTag) {
+			image.tags = append(image.tags, in.ImageTag)
+		}
+		f.mu.Unlock()
+		out = map[string]any{"image": map[string]any{"repositoryName": in.RepositoryName, "imageId": map[string]string{"imageDigest": d}}}
+	case "GetRegistryPolicy", "DescribeRegistry", "DescribePullThroughCacheRules", "GetRegistryScanningConfiguration", "DescribeRepositoryCreationTemplates":
+		f.mu.Lock()
+		setting, found := f.settings[operation]
+		f.mu.Unlock()
+		if !found {
+			f.fail(w, "RegistryPolicyNotFoundException", operation)
+			return
+		}
+		out = setting
+	case "PutRegistryPolicy", "PutReplicationConfiguration", "CreatePullThroughCacheRule", "PutRegistryScanningConfiguration", "CreateRepositoryCreationTemplate":
+		f.mu.Lock()
+		f.writes[operation] = append(f.writes[operation], json.RawMessage(body))
+		f.mu.Unlock()
+		out = map[string]any{}
+	default:
+		f.fail(w, "UnsupportedOperationException", operation)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (r *fakeRegistry) addIndex(repository, tag string, platforms ...ocispec.Platform) (manifest, error) {
+	index := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex}
+	index.SchemaVersion = 2
+
+	for _, platform := range platforms {
+		image, err := r.addImage(repository, platform.Architecture, []byte("layer-"+platform.OS+"-"+platform.Architecture))
+		if err != nil {
+			return manifest{}, err
+		}
+
+		index.Manifests = append(index.Manifests, ocispec.Descriptor{
+			MediaType: image.mediaType,
+			Digest:    digest.Digest(image.digest),
+			Size:      int64(len(image.raw)),
+			Platform:  &platform,
+		})
+	}
+
+	return r.addManifest(repository, tag, ocispec.MediaTypeImageIndex, index)
+}
+
+func (f *fakeEcr) addIndex(repository string, tags []string, platforms ...ocispec.Platform) *fakeEcrImage {
+	index := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex}
+	index.SchemaVersion = 2
+
+	for _, platform := range platforms {
+		image := f.addImage(repository, nil, []byte("layer-"+platform.OS+"-"+platform.Architecture))
+		index.Manifests = append(index.Manifests, ocispec.Descriptor{
+			MediaType: image.mediaType,
+			Digest:    digest.Digest(image.digest),
+			Size:      int64(len(image.manifest)),
+			Platform:  &platform,
+		})
+	}
+
+	raw, _ := json.Marshal(index)
+	image := &fakeEcrImage{
+		tags:      tags,
+		digest:    digest.FromBytes(raw).String(),
+		manifest:  string(raw),
+		mediaType: ocispec.MediaTypeImageIndex,
+	}
+
+	repo := f.repository(repository)
+	f.mu.Lock()
+	repo.images = append(repo.images, image)
+	f.mu.Unlock()
+	return image
+}
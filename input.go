@@ -1,37 +1,193 @@
 package main
 
-import "flag"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	engineDocker   = "docker"
+	engineRegistry = "registry"
+	engineECR      = "ecr"
+
+	commandRegistry = "registry"
+)
 
 type Args struct {
-	pullers     int
-	pushers     int
-	fromRegion  string
-	toRegion    string
-	fromProfile string
-	toProfile   string
-	file        string
+	command        string
+	pullers        int
+	pushers        int
+	copiers        int
+	engine         string
+	untagged       bool
+	platforms      []ocispec.Platform
+	plan           bool
+	output         string
+	checkpoint     string
+	resume         bool
+	force          bool
+	onConflict     string
+	lifecycle      string
+	reconcile      bool
+	conflictSuffix string
+	fromRegion     string
+	toRegion       string
+	fromProfile    string
+	toProfile      string
+	fromRole       string
+	toRole         string
+	fromExternalID string
+	toExternalID   string
+	fromMfaSerial  string
+	toMfaSerial    string
+	sessionName    string
+	allowSame      bool
+	retry          retrySettings
+	gracePeriod    time.Duration
+	reports        []string
+	mappings       []string
+	file           string
 }
 
-func NewArgsGetter() *Args {
+func NewArgsGetter() (*Args, error) {
 
 	var (
-		file        = flag.String("config_file", "list.yaml", "file with list of repositories")
-		fromRegion  = flag.String("from_region", "us-east-1", "default ecr client region")
-		toRegion    = flag.String("to_region", "us-east-1", "target ecr client region")
-		fromProfile = flag.String("from", "default", "default ecr origin profile")
-		toProfile   = flag.String("to", "HOME-LAB", "default ecr destination profile")
-		pullers     = flag.Int("pullers", 3, "set the amount of workers for pull images concurrently")
-		pushers     = flag.Int("pushers", 3, "set the amount of workers for push images concurrently")
+		file           = flag.String("config_file", "list.yaml", "file with list of repositories")
+		fromRegion     = flag.String("from_region", "us-east-1", "default ecr client region")
+		toRegion       = flag.String("to_region", "us-east-1", "target ecr client region")
+		fromProfile    = flag.String("from", "default", "default ecr origin profile")
+		toProfile      = flag.String("to", "HOME-LAB", "default ecr destination profile")
+		fromRole       = flag.String("from_role_arn", "", "role to assume in the origin account")
+		toRole         = flag.String("to_role_arn", "", "role to assume in the destination account")
+		fromExternalID = flag.String("from_external_id", "", "external id used when assuming the origin role")
+		toExternalID   = flag.String("to_external_id", "", "external id used when assuming the destination role")
+		fromMfaSerial  = flag.String("from_mfa_serial", "", "mfa device serial required by the origin role, the token is read from stdin")
+		toMfaSerial    = flag.String("to_mfa_serial", "", "mfa device serial required by the destination role, the token is read from stdin")
+		sessionName    = flag.String("role_session_name", "ecr-migrate", "session name used when assuming roles")
+		allowSame      = flag.Bool("allow_same_registry", false, "allow source and target to be the same registry without renaming repositories")
+		pullers        = flag.Int("pullers", 3, "set the amount of workers for pull images concurrently")
+		pushers        = flag.Int("pushers", 3, "set the amount of workers for push images concurrently")
+		copiers        = flag.Int("copiers", 3, "set the amount of workers for copy images concurrently with a daemonless engine")
+		engine         = flag.String("engine", engineDocker, "copy engine to use: docker, registry or ecr")
+		platforms      = flag.String("platforms", "", "comma separated os/arch[/variant] list to copy from multi-arch images, all platforms by default")
+		plan           = flag.Bool("plan", false, "print what would be migrated without creating or pushing anything")
+		output         = flag.String("output", outputText, "plan output format: text or json")
+		checkpoint     = flag.String("checkpoint", "ecr-migrate-state.json", "file where the migration progress is recorded, empty to disable")
+		resume         = flag.Bool("resume", false, "skip images already migrated according to the checkpoint file")
+		force          = flag.Bool("force", false, "copy every image even when the target already has the same digest")
+		onConflict     = flag.String("on_conflict", conflictOverwrite, "what to do when a target tag points at a different digest: skip, overwrite, fail or retag")
+		conflictSuffix = flag.String("conflict_suffix", "-migrated", "suffix appended to the tag when on_conflict is retag")
+		lifecycle      = flag.String("lifecycle_policy", lifecycleCopy, "lifecycle policy replication: copy (keep an existing target policy), override or skip")
+		reconcile      = flag.Bool("reconcile_settings", false, "update tag mutability, scan on push and resource tags of repositories that already exist in the target")
+		retryAttempts  = flag.Int("retry_max_attempts", 0, fmt.Sprintf("attempts per ecr api call and image pull, push or copy, overrides the config file (%d when unset)", defaultRetryAttempts))
+		retryBase      = flag.Duration("retry_base_delay", 0, fmt.Sprintf("initial backoff between attempts, doubled on each retry, overrides the config file (%s when unset)", defaultRetryBaseDelay))
+		retryMax       = flag.Duration("retry_max_delay", 0, fmt.Sprintf("maximum backoff between attempts, overrides the config file (%s when unset)", defaultRetryMaxDelay))
+		gracePeriod    = flag.Duration("shutdown_grace_period", defaultGracePeriod, "time in-flight transfers get to finish after SIGINT or SIGTERM before they are cancelled")
+		report         = flag.String("report", "", "comma separated files where the migration report is written, the format follows the extension: .json, .csv or .xml (junit)")
+		mapping        = flag.String("mapping", "", "comma separated files where source to target image references are written: .json or .sed")
+		untagged       = flag.Bool("untagged", false, "migrate untagged images by digest, requires the registry or ecr engine")
 	)
 
-	flag.Parse()
-	return &Args{
-		file:        *file,
-		fromRegion:  *fromRegion,
-		toRegion:    *toRegion,
-		fromProfile: *fromProfile,
-		toProfile:   *toProfile,
-		pullers:     *pullers,
-		pushers:     *pushers,
+	command := ""
+	if len(os.Args) > 1 && os.Args[1] == commandRegistry {
+		command = commandRegistry
+		if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+			return nil, configErr(err)
+		}
+	} else {
+		flag.Parse()
+	}
+
+	switch *engine {
+	case engineDocker, engineRegistry, engineECR:
+	default:
+		return nil, configErr(fmt.Errorf("unknown engine %q, expected docker, registry or ecr", *engine))
+	}
+
+	for _, workers := range []struct {
+		name  string
+		count int
+	}{{"copiers", *copiers}, {"pullers", *pullers}, {"pushers", *pushers}} {
+		if workers.count < 1 {
+			return nil, configErr(fmt.Errorf("--%s must be at least 1, got %d", workers.name, workers.count))
+		}
+	}
+
+	if err := validateConflictPolicy(*onConflict); err != nil {
+		return nil, configErr(err)
+	}
+
+	if err := validateLifecyclePolicy(*lifecycle); err != nil {
+		return nil, configErr(err)
 	}
+
+	if err := validateOutput(*output); err != nil {
+		return nil, configErr(err)
+	}
+
+	reports, err := parseReportPaths(*report)
+	if err != nil {
+		return nil, configErr(err)
+	}
+
+	mappings, err := parseMappingPaths(*mapping)
+	if err != nil {
+		return nil, configErr(err)
+	}
+
+	platformList, err := parsePlatforms(*platforms)
+	if err != nil {
+		return nil, configErr(err)
+	}
+	if len(platformList) > 0 && *engine == engineDocker {
+		return nil, configErr(errors.New("--platforms requires the registry or ecr engine"))
+	}
+	if *untagged && *engine == engineDocker {
+		return nil, configErr(errors.New("--untagged requires the registry or ecr engine"))
+	}
+
+	return &Args{
+		command:        command,
+		file:           *file,
+		fromRegion:     *fromRegion,
+		toRegion:       *toRegion,
+		fromProfile:    *fromProfile,
+		toProfile:      *toProfile,
+		fromRole:       *fromRole,
+		toRole:         *toRole,
+		fromExternalID: *fromExternalID,
+		toExternalID:   *toExternalID,
+		fromMfaSerial:  *fromMfaSerial,
+		toMfaSerial:    *toMfaSerial,
+		sessionName:    *sessionName,
+		allowSame:      *allowSame,
+		retry: retrySettings{
+			MaxAttempts: *retryAttempts,
+			BaseDelay:   *retryBase,
+			MaxDelay:    *retryMax,
+		},
+		gracePeriod:    *gracePeriod,
+		reports:        reports,
+		mappings:       mappings,
+		pullers:        *pullers,
+		pushers:        *pushers,
+		copiers:        *copiers,
+		engine:         *engine,
+		untagged:       *untagged,
+		platforms:      platformList,
+		plan:           *plan,
+		output:         *output,
+		checkpoint:     *checkpoint,
+		resume:         *resume,
+		force:          *force,
+		onConflict:     *onConflict,
+		lifecycle:      *lifecycle,
+		reconcile:      *reconcile,
+		conflictSuffix: *conflictSuffix,
+	}, nil
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+const (
+	lifecycleCopy     = "copy"
+	lifecycleOverride = "override"
+	lifecycleSkip     = "skip"
+)
+
+func validateLifecyclePolicy(policy string) error {
+	switch policy {
+	case "", lifecycleCopy, lifecycleOverride, lifecycleSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown lifecycle policy mode %q, expected copy, override or skip", policy)
+}
+
+type lifecyclePolicy struct {
+	fallback     string
+	repositories map[string]string
+}
+
+func newLifecyclePolicy(fallback string, repositories map[string]string) lifecyclePolicy {
+	return lifecyclePolicy{
+		fallback:     fallback,
+		repositories: repositories,
+	}
+}
+
+func (p lifecyclePolicy) forRepository(repository string) string {
+	if mode, found := p.repositories[repository]; found {
+		return mode
+	}
+	if p.fallback == "" {
+		return lifecycleCopy
+	}
+	return p.fallback
+}
+
+func (e *ECR) pullLifecyclePolicy(repositoryName string) string {
+	resp, err := e.ecr.GetLifecyclePolicy(e.ctx, &ecr.GetLifecyclePolicyInput{
+		RepositoryName: aws.String(repositoryName),
+	})
+
+	if err != nil {
+		var policyNotFoundErr *types.LifecyclePolicyNotFoundException
+		if !errors.As(err, &policyNotFoundErr) {
+			slog.Error("pullLifecyclePolicy", "error", err, "repository", repositoryName)
+		}
+		return ""
+	}
+
+	return aws.ToString(resp.LifecyclePolicyText)
+}
+
+func (e *ECR) setLifecyclePolicy(metadata repositoryMetadata, created bool) error {
+	mode := e.lifecycle.forRepository(metadata.repositoryName)
+	if mode == lifecycleSkip || metadata.lifecyclePolicy == "" {
+		return nil
+	}
+
+	repositoryName := metadata.targetRepository()
+	if !created && mode == lifecycleCopy {
+		if current := e.pullLifecyclePolicy(repositoryName); current != "" {
+			slog.Info("setLifecyclePolicy", "repository", repositoryName, "status", "already has a lifecycle policy")
+			return nil
+		}
+	}
+
+	_, err := e.ecr.PutLifecyclePolicy(e.ctx, &ecr.PutLifecyclePolicyInput{
+		RepositoryName:      aws.String(repositoryName),
+		LifecyclePolicyText: aws.String(metadata.lifecyclePolicy),
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("setLifecyclePolicy", "repository", repositoryName, "mode", mode, "status", "applied")
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecyclePolicy(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	const sourcePolicy = `{"rules":[{"rulePriority":1}]}`
+	const targetPolicy = `{"rules":[{"rulePriority":2}]}`
+
+	for _, name := range []string{"repo/test/app1", "repo/test/app2", "repo/test/app3", "repo/test/app4"} {
+		sourceRegistry.addImage(name, []string{"1.0"}, []byte("layer"))
+		sourceRegistry.repository(name).lifecyclePolicy = sourcePolicy
+	}
+	targetRegistry.repository("repo/test/app2").lifecyclePolicy = targetPolicy
+	targetRegistry.repository("repo/test/app3").lifecyclePolicy = targetPolicy
+
+	metadata := mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1", "repo/test/app2", "repo/test/app3", "repo/test/app4"})
+	if assert.Len(t, metadata.repoList, 4) {
+		assert.Equal(t, sourcePolicy, metadata.repoList[0].lifecyclePolicy)
+	}
+
+	target := targetRegistry.client().withLifecyclePolicy(newLifecyclePolicy(lifecycleCopy, map[string]string{
+		"repo/test/app3": lifecycleOverride,
+		"repo/test/app4": lifecycleSkip,
+	}))
+	target.validate(metadata)
+
+	assert.Equal(t, sourcePolicy, targetRegistry.repository("repo/test/app1").lifecyclePolicy, "expected the policy to be set on the created repository")
+	assert.Equal(t, targetPolicy, targetRegistry.repository("repo/test/app2").lifecyclePolicy, "expected an existing target policy to be kept")
+	assert.Equal(t, sourcePolicy, targetRegistry.repository("repo/test/app3").lifecyclePolicy, "expected the target policy to be overridden")
+	assert.Empty(t, targetRegistry.repository("repo/test/app4").lifecyclePolicy, "expected the policy to be skipped")
+}
+
+func TestValidateLifecyclePolicy(t *testing.T) {
+	for _, mode := range []string{"", lifecycleCopy, lifecycleOverride, lifecycleSkip} {
+		assert.NoError(t, validateLifecyclePolicy(mode))
+	}
+	assert.Error(t, validateLifecyclePolicy("merge"))
+}
@@ -1,31 +1,179 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 )
 
 func main() {
-	args := NewArgsGetter()
-
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
 	slog.SetDefault(logger)
 
+	if err := run(); err != nil {
+		slog.Error("ecrMigrate", "error", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func run() error {
+	args, err := NewArgsGetter()
+	if err != nil {
+		return err
+	}
+
 	repoFinder := newRepositoryFinder()
-	repositories := repoFinder.locateIn(args.file).registryList()
+	repositories, err := repoFinder.locateIn(args.file).registryList()
+	if err != nil {
+		return err
+	}
 
-	aws := mustInitConfig(
+	shutdown := newShutdown(args.gracePeriod).listen()
+	defer shutdown.stop()
+
+	retry := newRetryPolicy(args.retry, repositories.Retry).withContext(shutdown.ctx)
+	defer retry.report()
+
+	aws, err := initConfig(
 		withRegion(args.fromRegion),
 		withProfile(args.fromProfile),
+		withAssumeRole(args.fromRole, args.fromExternalID, args.sessionName, args.fromMfaSerial),
+		withRetryer(retry),
 	)
+	if err != nil {
+		return err
+	}
+
+	destinationAws, err := initConfig(
+		withRegion(args.toRegion),
+		withProfile(args.toProfile),
+		withAssumeRole(args.toRole, args.toExternalID, args.sessionName, args.toMfaSerial),
+		withRetryer(retry),
+	)
+	if err != nil {
+		return err
+	}
+
+	sourceIdentity, err := aws.callerIdentity("source")
+	if err != nil {
+		return err
+	}
+
+	targetIdentity, err := destinationAws.callerIdentity("target")
+	if err != nil {
+		return err
+	}
 
 	svc := aws.stablishClientWith(
 		ecrService(aws.cfg),
 	)
 
-	ecrRegistry := newEcr(svc.ecr)
-	imageMetadataList := ecrRegistry.walk(repositories.List)
+	destinationSvc := destinationAws.stablishClientWith(
+		ecrService(destinationAws.cfg),
+	)
+
+	ecrRegistry := newEcr(svc.ecr).withContext(shutdown.ctx).withUntagged(args.untagged)
+	destinationRegistry := newEcr(destinationSvc.ecr).
+		withContext(shutdown.ctx).
+		withKmsKeys(repositories.KmsKeys).
+		withPolicyRewrite(repositories.Policy.withTargetAccount(targetIdentity.account))
+
+	if args.command == commandRegistry {
+		if sourceIdentity.account == targetIdentity.account && sourceIdentity.region == targetIdentity.region && !args.allowSame {
+			return configErr(fmt.Errorf("source and target are the same registry (%s in %s)", sourceIdentity.account, sourceIdentity.region))
+		}
+
+		issues, err := newRegistryMigration(ecrRegistry, destinationRegistry).
+			withSettings(repositories.Registry).
+			withTargetAccount(targetIdentity.account).
+			withDryRun(args.plan).
+			migrate()
+		reportRegistryIssues(issues)
+		return shutdown.err(err)
+	}
+
+	if repositories.needsDiscovery() {
+		available, err := ecrRegistry.listRepositories()
+		if err != nil {
+			return err
+		}
+		repositories.resolve(available)
+	}
+
+	ecrRegistry.withFilters(repositories.tagFilters())
+	walked, err := ecrRegistry.walk(repositories.List)
+	if err != nil {
+		return shutdown.err(err)
+	}
+
+	imageMetadataList, err := repositories.rename(walked)
+	if err != nil {
+		return configErr(err)
+	}
+
+	if err := sameRegistryErr(sourceIdentity, targetIdentity, imageMetadataList); err != nil {
+		if !args.allowSame {
+			return configErr(err)
+		}
+		slog.Warn("sameRegistry", "error", err, "status", "allowed")
+	}
+
+	destinationRegistry.
+		withLifecyclePolicy(newLifecyclePolicy(args.lifecycle, repositories.lifecyclePolicies())).
+		withReconcileSettings(args.reconcile)
+	policy := newConflictPolicy(args.onConflict, args.conflictSuffix, repositories.conflictPolicies())
+
+	if args.plan {
+		plan, err := ecrRegistry.plan(destinationRegistry, imageMetadataList, policy)
+		if err != nil {
+			return err
+		}
+		return plan.print(os.Stdout, args.output)
+	}
+
+	imageMetadataList, err = ecrRegistry.reconcile(destinationRegistry, imageMetadataList, policy, args.force)
+	if err != nil {
+		return shutdown.err(err)
+	}
+	report := newMigrationReport().withTargetHost(targetIdentity.host()).addSkipped(imageMetadataList)
+	if err := conflictErr(imageMetadataList.conflicts); err != nil {
+		return errors.Join(err, report.write(args.reports))
+	}
+
+	if shutdown.stopping() {
+		return shutdown.err(errors.Join(report.write(args.reports), report.writeMappings(args.mappings)))
+	}
+
+	checkpoint, err := loadCheckpoint(args.checkpoint, args.resume)
+	if err != nil {
+		return err
+	}
+	checkpoint = checkpoint.withFlushInterval(defaultCheckpointFlushInterval)
+
+	switch args.engine {
+	case engineRegistry, engineECR:
+		err = newTransfer().withSource(ecrRegistry).withTarget(destinationRegistry).withCheckpoint(checkpoint).withShutdown(shutdown).withReport(report).withRetry(retry).addMetadataList(imageMetadataList).withArgs(args).migrate()
+	case engineDocker:
+		docker, cliErr := newDocker().startCli()
+		if cliErr != nil {
+			return errors.Join(cliErr, checkpoint.close())
+		}
+		err = docker.withSource(ecrRegistry).withTarget(destinationRegistry).withCheckpoint(checkpoint).withShutdown(shutdown).withReport(report).withRetry(retry).addMetadataList(imageMetadataList).withArgs(args).migrate()
+	default:
+		return configErr(fmt.Errorf("unknown engine %q", args.engine))
+	}
+
+	if checkpointErr := checkpoint.close(); checkpointErr != nil {
+		err = errors.Join(err, checkpointErr)
+	}
 
-	docker := newDocker().mustStartCli()
-	docker.addMetadataList(imageMetadataList).withArgs(args).migrate()
+	reportConflicts(imageMetadataList.conflicts)
+	if reportErr := report.write(args.reports); reportErr != nil {
+		err = errors.Join(err, reportErr)
+	}
+	if mappingErr := report.writeMappings(args.mappings); mappingErr != nil {
+		err = errors.Join(err, mappingErr)
+	}
+	return shutdown.err(err)
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var manifestMediaTypes = []string{
+	ocispec.MediaTypeImageManifest,
+	ocispec.MediaTypeImageIndex,
+	mediaTypeDockerManifest,
+	mediaTypeDockerManifestList,
+}
+
+type manifest struct {
+	raw       []byte
+	mediaType string
+	digest    string
+}
+
+func newManifest(raw []byte, mediaType, manifestDigest string) manifest {
+	if manifestDigest == "" {
+		manifestDigest = digest.FromBytes(raw).String()
+	}
+	return manifest{raw: raw, mediaType: mediaType, digest: manifestDigest}
+}
+
+func (m manifest) isIndex() bool {
+	switch m.mediaType {
+	case ocispec.MediaTypeImageIndex, mediaTypeDockerManifestList:
+		return true
+	case "":
+		var index ocispec.Index
+		return json.Unmarshal(m.raw, &index) == nil && len(index.Manifests) > 0
+	}
+	return false
+}
+
+func (m manifest) blobs() ([]ocispec.Descriptor, error) {
+	var image ocispec.Manifest
+	if err := json.Unmarshal(m.raw, &image); err != nil {
+		return nil, err
+	}
+
+	if image.Config.Digest == "" {
+		return nil, fmt.Errorf("unsupported manifest media type %q", m.mediaType)
+	}
+
+	return append([]ocispec.Descriptor{image.Config}, image.Layers...), nil
+}
+
+func (m manifest) children(platforms []ocispec.Platform) (manifest, []ocispec.Descriptor, error) {
+	var index ocispec.Index
+	if err := json.Unmarshal(m.raw, &index); err != nil {
+		return manifest{}, nil, err
+	}
+
+	if len(platforms) == 0 {
+		return m, index.Manifests, nil
+	}
+
+	selected := make([]ocispec.Descriptor, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		if matchPlatform(desc.Platform, platforms) {
+			selected = append(selected, desc)
+		}
+	}
+
+	if len(selected) == 0 {
+		return manifest{}, nil, fmt.Errorf("no manifest in the index matches the platforms %s", formatPlatforms(platforms))
+	}
+
+	if len(selected) == len(index.Manifests) {
+		return m, selected, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(m.raw, &fields); err != nil {
+		return manifest{}, nil, err
+	}
+
+	b, err := json.Marshal(selected)
+	if err != nil {
+		return manifest{}, nil, err
+	}
+	fields["manifests"] = b
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return manifest{}, nil, err
+	}
+
+	return newManifest(raw, m.mediaType, ""), selected, nil
+}
+
+func parsePlatforms(value string) ([]ocispec.Platform, error) {
+	var platforms []ocispec.Platform
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		parts := strings.Split(p, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", p)
+		}
+
+		platform := ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+		platforms = append(platforms, platform)
+	}
+
+	return platforms, nil
+}
+
+func matchPlatform(platform *ocispec.Platform, platforms []ocispec.Platform) bool {
+	if platform == nil {
+		return false
+	}
+
+	for _, p := range platforms {
+		if p.OS == platform.OS && p.Architecture == platform.Architecture && (p.Variant == "" || p.Variant == platform.Variant) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatPlatforms(platforms []ocispec.Platform) string {
+	list := make([]string, len(platforms))
+	for i, p := range platforms {
+		list[i] = strings.TrimSuffix(p.OS+"/"+p.Architecture+"/"+p.Variant, "/")
+	}
+	return strings.Join(list, ",")
+}
+
+type manifestCopier interface {
+	getManifest(reference imageReference) (manifest, error)
+	copyBlobs(from, to imageReference, blobs []ocispec.Descriptor) error
+	putManifest(reference imageReference, m manifest) (string, error)
+}
+
+func copyManifest(c manifestCopier, from, to imageReference, platforms []ocispec.Platform) (string, error) {
+	m, err := c.getManifest(from)
+	if err != nil {
+		return "", err
+	}
+
+	if m.isIndex() {
+		index, children, err := m.children(platforms)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", from.repository, err)
+		}
+
+		for _, child := range children {
+			childFrom, childTo := from, to
+			childFrom.reference, childTo.reference = child.Digest.String(), child.Digest.String()
+
+			if _, err := copyManifest(c, childFrom, childTo, nil); err != nil {
+				return "", err
+			}
+		}
+
+		if index.digest != m.digest {
+			slog.Info("manifestCopy", "repository", to.repository, "reference", to.reference, "platforms", formatPlatforms(platforms), "manifests", len(children), "status", "index filtered")
+			if strings.HasPrefix(to.reference, "sha256:") {
+				to.reference = index.digest
+			}
+		}
+		m = index
+	} else {
+		blobs, err := m.blobs()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", from.repository, err)
+		}
+
+		if err := c.copyBlobs(from, to, blobs); err != nil {
+			return "", err
+		}
+	}
+
+	pushed, err := c.putManifest(to, m)
+	if err != nil {
+		return "", err
+	}
+
+	if pushed != "" && pushed != m.digest {
+		return "", fmt.Errorf("digest mismatch for %s:%s, expected %s but target has %s", to.repository, to.reference, m.digest, pushed)
+	}
+
+	slog.Info("manifestCopy", "repository", to.repository, "reference", to.reference, "digest", m.digest, "status", "verified")
+	return m.digest, nil
+}
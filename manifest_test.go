@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	platforms, err := parsePlatforms("linux/amd64, linux/arm64/v8")
+	assert.NoError(t, err)
+	assert.Equal(t, []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}, platforms)
+	assert.Equal(t, "linux/amd64,linux/arm64/v8", formatPlatforms(platforms))
+
+	platforms, err = parsePlatforms("")
+	assert.NoError(t, err)
+	assert.Empty(t, platforms)
+
+	_, err = parsePlatforms("linux")
+	assert.Error(t, err)
+}
+
+func TestManifestChildren(t *testing.T) {
+	index := ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{
+			{Digest: "sha256:amd64", Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+			{Digest: "sha256:arm64", Platform: &ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+			{Digest: "sha256:attestation", Platform: &ocispec.Platform{OS: "unknown", Architecture: "unknown"}},
+		},
+	}
+	index.SchemaVersion = 2
+
+	raw, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newManifest(raw, ocispec.MediaTypeImageIndex, "")
+	assert.True(t, m.isIndex())
+
+	all, children, err := m.children(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, m, all)
+	assert.Len(t, children, 3)
+
+	filtered, children, err := m.children([]ocispec.Platform{{OS: "linux", Architecture: "arm64"}})
+	assert.NoError(t, err)
+	assert.Len(t, children, 1)
+	assert.NotEqual(t, m.digest, filtered.digest)
+
+	var filteredIndex ocispec.Index
+	assert.NoError(t, json.Unmarshal(filtered.raw, &filteredIndex))
+	assert.Equal(t, index.MediaType, filteredIndex.MediaType)
+	assert.Equal(t, children, filteredIndex.Manifests)
+
+	_, _, err = m.children([]ocispec.Platform{{OS: "windows", Architecture: "amd64"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	mappingJSON = ".json"
+	mappingSed  = ".sed"
+
+	sedBoundary = `[^A-Za-z0-9._@-]`
+)
+
+type imageMapping struct {
+	source string
+	target string
+}
+
+func parseMappingPaths(value string) ([]string, error) {
+	return parseOutputPaths(value, mappingJSON, mappingSed)
+}
+
+func (r *migrationReport) mappings() []imageMapping {
+	targets := make(map[string]string)
+	for _, image := range r.document().Images {
+		switch image.Outcome {
+		case outcomeCopied, outcomeMigrated, outcomeUpToDate:
+		default:
+			continue
+		}
+
+		from, err := parseImageReference(image.Source)
+		if err != nil {
+			continue
+		}
+		to, err := parseImageReference(image.Target)
+		if err != nil {
+			continue
+		}
+
+		if !strings.HasPrefix(image.Reference, "sha256:") {
+			targets[image.Source] = image.Target
+		}
+		if image.Digest != "" && image.TargetDigest != "" {
+			targets[from.host+"/"+from.repository+"@"+image.Digest] = to.host + "/" + to.repository + "@" + image.TargetDigest
+		}
+	}
+
+	mappings := make([]imageMapping, 0, len(targets))
+	for source, target := range targets {
+		mappings = append(mappings, imageMapping{source: source, target: target})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].source < mappings[j].source
+	})
+	return mappings
+}
+
+func (r *migrationReport) writeMappings(paths []string) error {
+	if r == nil || len(paths) == 0 {
+		return nil
+	}
+
+	mappings := r.mappings()
+
+	var errs []error
+	for _, path := range paths {
+		if err := writeMappingFile(path, mappings); err != nil {
+			errs = append(errs, fmt.Errorf("mapping %s: %w", path, err))
+			continue
+		}
+		slog.Info("imageMapping", "path", path, "images", len(mappings), "status", "written")
+	}
+	return errors.Join(errs...)
+}
+
+func writeMappingFile(path string, mappings []imageMapping) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := encodeMappings(file, filepath.Ext(path), mappings); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func encodeMappings(w io.Writer, format string, mappings []imageMapping) error {
+	switch format {
+	case mappingJSON:
+		targets := make(map[string]string, len(mappings))
+		for _, m := range mappings {
+			targets[m.source] = m.target
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(targets)
+	case mappingSed:
+		if _, err := fmt.Fprintln(w, "# usage: sed -i -f mapping.sed <files>"); err != nil {
+			return err
+		}
+
+		for _, m := range mappings {
+			pattern, replacement := sedPattern(m.source), sedReplacement(m.target)
+			if _, err := fmt.Fprintf(w, "s|%s\\(%s\\)|%s\\1|g\ns|%s$|%s|\n", pattern, sedBoundary, replacement, pattern, replacement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown mapping format %q", format)
+}
+
+func sedPattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\.*[]^$|`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func sedReplacement(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\&|`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappings(t *testing.T) {
+	source := "111111111111.dkr.ecr.us-east-1.amazonaws.com/repo/test/app1"
+	target := "222222222222.dkr.ecr.us-east-1.amazonaws.com/platform/app1"
+
+	report := newMigrationReport()
+	report.add(reportEntry{Repository: "repo/test/app1", Reference: "1.0", Source: source + ":1.0", Target: target + ":1.0", Digest: "sha256:aaa", TargetDigest: "sha256:bbb", Outcome: outcomeCopied})
+	report.add(reportEntry{Repository: "repo/test/app1", Reference: "2.0", Source: source + ":2.0", Target: target + ":2.0-migrated", Digest: "sha256:ccc", TargetDigest: "sha256:ccc", Outcome: outcomeCopied})
+	report.add(reportEntry{Repository: "repo/test/app1", Reference: "3.0", Source: source + ":3.0", Target: target + ":3.0", Digest: "sha256:ddd", TargetDigest: "sha256:ddd", Outcome: outcomeUpToDate})
+	report.add(reportEntry{Repository: "repo/test/app1", Reference: "sha256:eee", Source: source + "@sha256:eee", Target: target + "@sha256:eee", Digest: "sha256:eee", TargetDigest: "sha256:eee", Outcome: outcomeCopied})
+	report.add(reportEntry{Repository: "repo/test/app1", Reference: "4.0", Source: source + ":4.0", Target: target + ":4.0", Digest: "sha256:fff", Outcome: outcomeMigrated})
+	report.add(reportEntry{Repository: "repo/test/app1", Reference: "5.0", Source: source + ":5.0", Target: target + ":5.0", Digest: "sha256:123", Outcome: outcomeFailed})
+
+	assert.Equal(t, []imageMapping{
+		{source: source + ":1.0", target: target + ":1.0"},
+		{source: source + ":2.0", target: target + ":2.0-migrated"},
+		{source: source + ":3.0", target: target + ":3.0"},
+		{source: source + ":4.0", target: target + ":4.0"},
+		{source: source + "@sha256:aaa", target: target + "@sha256:bbb"},
+		{source: source + "@sha256:ccc", target: target + "@sha256:ccc"},
+		{source: source + "@sha256:ddd", target: target + "@sha256:ddd"},
+		{source: source + "@sha256:eee", target: target + "@sha256:eee"},
+	}, report.mappings())
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "mapping.json"), filepath.Join(dir, "mapping.sed")}
+	assert.NoError(t, report.writeMappings(paths))
+
+	b, err := os.ReadFile(paths[0])
+	assert.NoError(t, err)
+	var targets map[string]string
+	assert.NoError(t, json.Unmarshal(b, &targets))
+	assert.Len(t, targets, 8)
+	assert.Equal(t, target+"@sha256:bbb", targets[source+"@sha256:aaa"])
+
+	b, err = os.ReadFile(paths[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `s|111111111111\.dkr\.ecr\.us-east-1\.amazonaws\.com/repo/test/app1:1\.0\(`+sedBoundary+`\)|222222222222.dkr.ecr.us-east-1.amazonaws.com/platform/app1:1.0\1|g`)
+	assert.Contains(t, string(b), `s|111111111111\.dkr\.ecr\.us-east-1\.amazonaws\.com/repo/test/app1:1\.0$|222222222222.dkr.ecr.us-east-1.amazonaws.com/platform/app1:1.0|`)
+	assert.Equal(t, 17, bytes.Count(b, []byte("\n")))
+
+	_, err = parseMappingPaths("mapping.yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+type prefixRule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+type naming struct {
+	Prefixes []prefixRule `yaml:"prefixes"`
+	Template string       `yaml:"template"`
+	tmpl     *template.Template
+}
+
+type namingData struct {
+	Account string
+	Region  string
+	Name    string
+}
+
+func (n *naming) compile() error {
+	if n.Template == "" {
+		return nil
+	}
+
+	tmpl, err := template.New("naming").Option("missingkey=error").Parse(n.Template)
+	if err != nil {
+		return fmt.Errorf("invalid naming template: %w", err)
+	}
+
+	n.tmpl = tmpl
+	return nil
+}
+
+func registryFromURI(repositoryURI string) (account, region string) {
+	host, _, _ := strings.Cut(repositoryURI, "/")
+	parts := strings.Split(host, ".")
+	if len(parts) < 4 || parts[1] != "dkr" || parts[2] != "ecr" {
+		return "", ""
+	}
+	return parts[0], parts[3]
+}
+
+func (n naming) targetName(name, repositoryURI string) (string, error) {
+	for _, rule := range n.Prefixes {
+		if strings.HasPrefix(name, rule.From) {
+			return rule.To + strings.TrimPrefix(name, rule.From), nil
+		}
+	}
+
+	if n.tmpl == nil {
+		return name, nil
+	}
+
+	account, region := registryFromURI(repositoryURI)
+
+	var b strings.Builder
+	if err := n.tmpl.Execute(&b, namingData{Account: account, Region: region, Name: name}); err != nil {
+		return "", fmt.Errorf("naming template for %s: %w", name, err)
+	}
+	return strings.Trim(b.String(), "/ "), nil
+}
+
+func (r *Repositories) rename(data metadataList) (metadataList, error) {
+	sources := make(map[string]string, len(data.repoList))
+	for i, metadata := range data.repoList {
+		target := ""
+		if entry, found := r.entryFor(metadata.repositoryName); found {
+			target = entry.Target
+		}
+
+		if target == "" {
+			var err error
+			if target, err = r.Naming.targetName(metadata.repositoryName, metadata.repositoryURI); err != nil {
+				return data, err
+			}
+		}
+
+		if source, found := sources[target]; found {
+			return data, fmt.Errorf("repositories %s and %s are both mapped to %s", source, metadata.repositoryName, target)
+		}
+		sources[target] = metadata.repositoryName
+
+		data.repoList[i].targetName = target
+	}
+
+	return data, nil
+}
+
+func sameRegistryErr(source, target registryIdentity, data metadataList) error {
+	if source.account != target.account || source.region != target.region {
+		return nil
+	}
+
+	var unchanged []string
+	for _, metadata := range data.repoList {
+		if metadata.targetRepository() == metadata.repositoryName {
+			unchanged = append(unchanged, metadata.repositoryName)
+		}
+	}
+
+	if len(unchanged) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("source and target are the same registry (%s in %s), %d repositories would be copied onto themselves: %s. rename them or use --allow_same_registry",
+		source.account, source.region, len(unchanged), strings.Join(unchanged, ", "))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetName(t *testing.T) {
+	n := naming{
+		Prefixes: []prefixRule{{From: "legacy/", To: "platform/"}},
+		Template: "{{ .Region }}/{{ .Account }}/{{ .Name }}",
+	}
+	if err := n.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := "111111111111.dkr.ecr.us-east-1.amazonaws.com/repo/test/app1"
+
+	name, err := n.targetName("legacy/app1", uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "platform/app1", name)
+
+	name, err = n.targetName("repo/test/app1", uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1/111111111111/repo/test/app1", name)
+
+	name, err = naming{}.targetName("repo/test/app1", uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "repo/test/app1", name)
+
+	assert.Error(t, (&naming{Template: "{{ .Name"}).compile())
+}
+
+func TestRenameRepositories(t *testing.T) {
+	repositories := createTempConfig(t, `repositories:
+  - name: repo/test/app1
+    target: platform/app1
+  - legacy/app2
+  - repo/test/app3
+naming:
+  prefixes:
+    - from: legacy/
+      to: platform/
+`)
+
+	data, err := repositories.rename(metadataList{repoList: []repositoryMetadata{
+		{repositoryName: "repo/test/app1"},
+		{repositoryName: "legacy/app2"},
+		{repositoryName: "repo/test/app3"},
+	}})
+	assert.NoError(t, err)
+
+	targets := make([]string, len(data.repoList))
+	for i, metadata := range data.repoList {
+		targets[i] = metadata.targetRepository()
+	}
+	assert.Equal(t, []string{"platform/app1", "platform/app2", "repo/test/app3"}, targets)
+
+	_, err = repositories.rename(metadataList{repoList: []repositoryMetadata{
+		{repositoryName: "legacy/app1"},
+		{repositoryName: "repo/test/app1"},
+	}})
+	assert.Error(t, err, "expected two sources mapped to the same target to be rejected")
+}
+
+func TestPlanRenamedRepository(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	targetRegistry.addImage("platform/app1", []string{"1.0"}, []byte("layer-1.0"))
+
+	metadata := mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1"})
+	metadata.repoList[0].targetName = "platform/app1"
+
+	plan, err := sourceRegistry.client().plan(targetRegistry.client(), metadata, newConflictPolicy(conflictOverwrite, "", nil))
+	assert.NoError(t, err)
+	if assert.Len(t, plan.Repositories, 1) {
+		assert.Equal(t, "platform/app1", plan.Repositories[0].Target)
+		assert.Equal(t, planExists, plan.Repositories[0].Action)
+	}
+	assert.Equal(t, 1, plan.UpToDate, "expected the image to be compared against the renamed repository")
+}
+
+func TestSameRegistryErr(t *testing.T) {
+	source := registryIdentity{account: "111111111111", region: "us-east-1"}
+	data := metadataList{repoList: []repositoryMetadata{
+		{repositoryName: "repo/test/app1", targetName: "platform/app1"},
+		{repositoryName: "repo/test/app2"},
+	}}
+
+	assert.NoError(t, sameRegistryErr(source, registryIdentity{account: "222222222222", region: "us-east-1"}, data))
+	assert.NoError(t, sameRegistryErr(source, registryIdentity{account: "111111111111", region: "eu-west-1"}, data))
+
+	err := sameRegistryErr(source, source, data)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "repo/test/app2")
+		assert.NotContains(t, err.Error(), "repo/test/app1")
+	}
+
+	data.repoList[1].targetName = "platform/app2"
+	assert.NoError(t, sameRegistryErr(source, source, data), "expected renamed repositories to be allowed")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+)
+
+const (
+	planCreate   = "create"
+	planExists   = "exists"
+	planCopy     = "copy"
+	planUpToDate = "up to date"
+
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type imagePlan struct {
+	Reference string `json:"reference"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Action    string `json:"action"`
+}
+
+type policyPlan struct {
+	Original  string   `json:"original"`
+	Rewritten string   `json:"rewritten"`
+	Diff      []string `json:"diff"`
+}
+
+type repositoryPlan struct {
+	Name   string      `json:"name"`
+	Target string      `json:"target"`
+	Action string      `json:"action"`
+	Bytes  int64       `json:"bytes"`
+	Policy *policyPlan `json:"policy,omitempty"`
+	Images []imagePlan `json:"images"`
+}
+
+type Plan struct {
+	Repositories []repositoryPlan `json:"repositories"`
+	Create       int              `json:"create"`
+	Copy         int              `json:"copy"`
+	UpToDate     int              `json:"up_to_date"`
+	Conflicts    int              `json:"conflicts"`
+	Bytes        int64            `json:"bytes"`
+}
+
+func (e *ECR) plan(target *ECR, data metadataList, policy conflictPolicy) (Plan, error) {
+	var plan Plan
+	for _, metadata := range data.repoList {
+		repository := repositoryPlan{
+			Name:   metadata.repositoryName,
+			Target: metadata.targetRepository(),
+			Action: planExists,
+		}
+
+		comparison, err := e.compareImages(target, metadata)
+		if err != nil {
+			return Plan{}, err
+		}
+
+		if !comparison.exists {
+			repository.Action = planCreate
+			plan.Create++
+			if repository.Policy, err = target.planPolicy(metadata); err != nil {
+				return Plan{}, err
+			}
+		}
+
+		for _, reference := range slices.Concat(metadata.tags, metadata.digests) {
+			image := imagePlan{
+				Reference: reference,
+				Digest:    comparison.source[reference].digest,
+				Size:      comparison.source[reference].size,
+				Action:    planCopy,
+			}
+
+			if _, found := comparison.target[reference]; found {
+				image.Action = policy.forRepository(metadata.repositoryName)
+				if comparison.upToDate(reference) {
+					image.Action = planUpToDate
+				}
+			}
+
+			switch image.Action {
+			case planUpToDate:
+				plan.UpToDate++
+			case conflictSkip, conflictFail:
+				plan.Conflicts++
+			default:
+				plan.Copy++
+				repository.Bytes += image.Size
+			}
+			repository.Images = append(repository.Images, image)
+		}
+
+		plan.Bytes += repository.Bytes
+		plan.Repositories = append(plan.Repositories, repository)
+	}
+
+	return plan, nil
+}
+
+func (e *ECR) planPolicy(metadata repositoryMetadata) (*policyPlan, error) {
+	if metadata.repositoryPolicy == "" || !e.policyRewrite.enabled() {
+		return nil, nil
+	}
+
+	rewritten, err := e.policyRewrite.rewrite(metadata.targetRepository(), metadata.repositoryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	original := indentPolicy(metadata.repositoryPolicy)
+	rewritten = indentPolicy(rewritten)
+	if original == rewritten {
+		return nil, nil
+	}
+
+	return &policyPlan{
+		Original:  original,
+		Rewritten: rewritten,
+		Diff:      diffLines(original, rewritten),
+	}, nil
+}
+
+func validateOutput(output string) error {
+	switch output {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected text or json", output)
+}
+
+func (p Plan) print(w io.Writer, output string) error {
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	case outputText:
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, repository := range p.Repositories {
+		fmt.Fprintf(tw, "%s -> %s\t%s\t%s\n", repository.Name, repository.Target, repository.Action, formatBytes(repository.Bytes))
+		if repository.Policy != nil {
+			fmt.Fprintln(tw, "  repository policy:")
+			for _, line := range repository.Policy.Diff {
+				fmt.Fprintf(tw, "    %s\n", line)
+			}
+		}
+		for _, image := range repository.Images {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", image.Reference, image.Action, formatBytes(image.Size), image.Digest)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nrepositories to create: %d, images to copy: %d, images up to date: %d, conflicts not copied: %d, total: %s\n", p.Create, p.Copy, p.UpToDate, p.Conflicts, formatBytes(p.Bytes))
+	return tw.Flush()
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
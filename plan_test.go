@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	current := sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	changed := sourceRegistry.addImage("repo/test/app1", []string{"1.1"}, []byte("layer-1.1"))
+	added := sourceRegistry.addImage("repo/test/app1", []string{"1.2"}, []byte("layer-1.2"))
+	created := sourceRegistry.addImage("repo/test/app2", []string{"2.0"}, []byte("layer-2.0"))
+
+	targetRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1.0"))
+	targetRegistry.addImage("repo/test/app1", []string{"1.1"}, []byte("layer-1.1-changed"))
+
+	source := sourceRegistry.client()
+	metadata := mustWalk(t, source, []string{"repo/test/app1", "repo/test/app2"})
+	plan, err := source.plan(targetRegistry.client(), metadata, newConflictPolicy(conflictOverwrite, "", nil))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []repositoryPlan{
+		{
+			Name:   "repo/test/app1",
+			Target: "repo/test/app1",
+			Action: planExists,
+			Bytes:  changed.size + added.size,
+			Images: []imagePlan{
+				{Reference: "1.0", Digest: current.digest, Size: current.size, Action: planUpToDate},
+				{Reference: "1.1", Digest: changed.digest, Size: changed.size, Action: conflictOverwrite},
+				{Reference: "1.2", Digest: added.digest, Size: added.size, Action: planCopy},
+			},
+		},
+		{
+			Name:   "repo/test/app2",
+			Target: "repo/test/app2",
+			Action: planCreate,
+			Bytes:  created.size,
+			Images: []imagePlan{
+				{Reference: "2.0", Digest: created.digest, Size: created.size, Action: planCopy},
+			},
+		},
+	}, plan.Repositories)
+	assert.Equal(t, 1, plan.Create)
+	assert.Equal(t, 3, plan.Copy)
+	assert.Equal(t, 1, plan.UpToDate)
+	assert.Equal(t, changed.size+added.size+created.size, plan.Bytes)
+	assert.Equal(t, 0, targetRegistry.calls["CreateRepository"], "expected plan not to create repositories")
+
+	var text bytes.Buffer
+	assert.NoError(t, plan.print(&text, outputText))
+	assert.Contains(t, text.String(), "repositories to create: 1, images to copy: 3, images up to date: 1, conflicts not copied: 0")
+
+	var out bytes.Buffer
+	assert.NoError(t, plan.print(&out, outputJSON))
+
+	var decoded Plan
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, plan, decoded)
+
+	assert.Error(t, plan.print(&out, "yaml"))
+	assert.NoError(t, validateOutput(outputJSON))
+	assert.Error(t, validateOutput("yaml"))
+
+	skipped, err := source.plan(targetRegistry.client(), metadata, newConflictPolicy(conflictOverwrite, "", map[string]string{"repo/test/app1": conflictSkip}))
+	assert.NoError(t, err)
+	assert.Equal(t, conflictSkip, skipped.Repositories[0].Images[1].Action)
+	assert.Equal(t, 1, skipped.Conflicts)
+	assert.Equal(t, 2, skipped.Copy)
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
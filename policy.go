@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+var accountPattern = regexp.MustCompile(`^\d{12}$`)
+
+type policyRewrite struct {
+	Accounts      map[string]string `yaml:"accounts"`
+	Principals    map[string]string `yaml:"principals"`
+	Organizations map[string]string `yaml:"organizations"`
+	RemoveUnknown bool              `yaml:"remove_unknown_principals"`
+	targetAccount string
+}
+
+func (r policyRewrite) withTargetAccount(account string) policyRewrite {
+	r.targetAccount = account
+	return r
+}
+
+func (r policyRewrite) enabled() bool {
+	return len(r.Accounts) > 0 || len(r.Principals) > 0 || len(r.Organizations) > 0 || r.RemoveUnknown
+}
+
+func (r policyRewrite) rewrite(repository, policy string) (string, error) {
+	if policy == "" || !r.enabled() {
+		return policy, nil
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		return "", fmt.Errorf("parsing policy of %s: %w", repository, err)
+	}
+
+	var statements []any
+	switch statement := document["Statement"].(type) {
+	case []any:
+		statements = statement
+	case map[string]any:
+		statements = []any{statement}
+	}
+
+	kept := make([]any, 0, len(statements))
+	for _, statement := range statements {
+		statement = r.rewriteValue(statement)
+		if r.RemoveUnknown {
+			if principal, unknown := r.unknownPrincipal(statement); unknown {
+				slog.Warn("policyRewrite", "repository", repository, "principal", principal, "status", "statement removed")
+				continue
+			}
+		}
+		kept = append(kept, statement)
+	}
+
+	if len(kept) == 0 {
+		slog.Warn("policyRewrite", "repository", repository, "status", "no statement left, policy not applied")
+		return "", nil
+	}
+	document["Statement"] = kept
+
+	b, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r policyRewrite) rewriteValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = r.rewriteValue(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.rewriteValue(item)
+		}
+		return v
+	case string:
+		return r.rewriteString(v)
+	}
+	return value
+}
+
+func (r policyRewrite) rewriteString(value string) string {
+	if mapped, found := r.Principals[value]; found {
+		return mapped
+	}
+	if mapped, found := r.Organizations[value]; found {
+		return mapped
+	}
+	if mapped, found := r.Accounts[value]; found {
+		return mapped
+	}
+
+	if strings.HasPrefix(value, "arn:") {
+		parts := strings.SplitN(value, ":", 6)
+		if len(parts) == 6 {
+			if mapped, found := r.Accounts[parts[4]]; found {
+				parts[4] = mapped
+				return strings.Join(parts, ":")
+			}
+		}
+	}
+
+	return value
+}
+
+func (r policyRewrite) known(account string) bool {
+	if account == r.targetAccount {
+		return true
+	}
+	for _, mapped := range r.Accounts {
+		if mapped == account {
+			return true
+		}
+	}
+	for _, mapped := range r.Principals {
+		if principalAccount(mapped) == account {
+			return true
+		}
+	}
+	return false
+}
+
+func principalAccount(principal string) string {
+	if accountPattern.MatchString(principal) {
+		return principal
+	}
+
+	parts := strings.SplitN(principal, ":", 6)
+	if len(parts) == 6 && parts[0] == "arn" {
+		return parts[4]
+	}
+	return ""
+}
+
+func (r policyRewrite) unknownPrincipal(statement any) (string, bool) {
+	fields, ok := statement.(map[string]any)
+	if !ok {
+		return "", false
+	}
+
+	for _, key := range []string{"Principal", "NotPrincipal"} {
+		principal, ok := fields[key].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		var values []any
+		switch aws := principal["AWS"].(type) {
+		case string:
+			values = []any{aws}
+		case []any:
+			values = aws
+		}
+
+		for _, value := range values {
+			name, _ := value.(string)
+			if account := principalAccount(name); account != "" && !r.known(account) {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func indentPolicy(policy string) string {
+	var document any
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		return policy
+	}
+
+	b, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return policy
+	}
+	return string(b)
+}
+
+func diffLines(before, after string) []string {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+	return diff
+}
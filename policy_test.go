@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRepositoryPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "pull",
+      "Effect": "Allow",
+      "Principal": {"AWS": ["arn:aws:iam::111111111111:role/ci", "arn:aws:iam::111111111111:role/deploy"]},
+      "Action": ["ecr:BatchGetImage"],
+      "Condition": {"StringEquals": {"aws:PrincipalOrgID": "o-source"}}
+    },
+    {
+      "Sid": "partner",
+      "Effect": "Allow",
+      "Principal": {"AWS": "333333333333"},
+      "Action": ["ecr:BatchGetImage"]
+    }
+  ]
+}`
+
+func TestPolicyRewrite(t *testing.T) {
+	rewrite := policyRewrite{
+		Accounts:      map[string]string{"111111111111": "222222222222"},
+		Principals:    map[string]string{"arn:aws:iam::111111111111:role/ci": "arn:aws:iam::222222222222:role/build"},
+		Organizations: map[string]string{"o-source": "o-target"},
+		RemoveUnknown: true,
+	}
+
+	policy, err := rewrite.rewrite("repo/test/app1", testRepositoryPolicy)
+	assert.NoError(t, err)
+
+	var document struct {
+		Statement []struct {
+			Sid       string
+			Principal struct{ AWS any }
+			Condition map[string]map[string]string
+		}
+	}
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, document.Statement, 1, "expected the statement with an unknown principal to be removed") {
+		statement := document.Statement[0]
+		assert.Equal(t, "pull", statement.Sid)
+		assert.Equal(t, []any{"arn:aws:iam::222222222222:role/build", "arn:aws:iam::222222222222:role/deploy"}, statement.Principal.AWS)
+		assert.Equal(t, "o-target", statement.Condition["StringEquals"]["aws:PrincipalOrgID"])
+	}
+
+	unchanged, err := policyRewrite{}.rewrite("repo/test/app1", testRepositoryPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, testRepositoryPolicy, unchanged, "expected the policy to be kept verbatim without rewrite rules")
+
+	_, err = rewrite.rewrite("repo/test/app1", "{")
+	assert.Error(t, err)
+
+	empty, err := rewrite.rewrite("repo/test/app1", `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::999999999999:root"},"Action":"ecr:BatchGetImage"}]}`)
+	assert.NoError(t, err)
+	assert.Empty(t, empty, "expected no policy when every statement is removed")
+
+	kept, err := rewrite.withTargetAccount("999999999999").rewrite("repo/test/app1", `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::999999999999:root"},"Action":"ecr:BatchGetImage"}]}`)
+	assert.NoError(t, err)
+	assert.Contains(t, kept, "arn:aws:iam::999999999999:root", "expected principals of the target account to be known")
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := diffLines("a\nb\nc", "a\nx\nc\nd")
+	assert.Equal(t, []string{"  a", "- b", "+ x", "  c", "+ d"}, diff)
+}
+
+func TestPlanPolicy(t *testing.T) {
+	target := newEcr(nil).withPolicyRewrite(policyRewrite{Accounts: map[string]string{"111111111111": "222222222222"}})
+
+	policy, err := target.planPolicy(repositoryMetadata{repositoryName: "repo/test/app1", repositoryPolicy: testRepositoryPolicy})
+	assert.NoError(t, err)
+	if assert.NotNil(t, policy) {
+		assert.Contains(t, policy.Diff, `-           "arn:aws:iam::111111111111:role/ci",`)
+		assert.Contains(t, policy.Diff, `+           "arn:aws:iam::222222222222:role/ci",`)
+	}
+
+	policy, err = newEcr(nil).planPolicy(repositoryMetadata{repositoryPolicy: testRepositoryPolicy})
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+}
@@ -1,14 +1,43 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Repositories struct {
-	Path string
-	List []string `yaml:"repositories"`
+	Path     string
+	List     []string           `yaml:"-"`
+	Entries  []repositoryConfig `yaml:"repositories"`
+	Filters  *tagFilter         `yaml:"filters"`
+	Discover string             `yaml:"discover"`
+	Exclude  []string           `yaml:"exclude_repositories"`
+	Naming   naming             `yaml:"naming"`
+	KmsKeys  map[string]string  `yaml:"kms_keys"`
+	Policy   policyRewrite      `yaml:"policy_rewrite"`
+	Registry registrySettings   `yaml:"registry"`
+	Retry    retrySettings      `yaml:"retry"`
+	filter   *compiledFilter
+}
+
+type repositoryConfig struct {
+	Name       string     `yaml:"name"`
+	Target     string     `yaml:"target"`
+	OnConflict string     `yaml:"on_conflict"`
+	Lifecycle  string     `yaml:"lifecycle_policy"`
+	Filters    *tagFilter `yaml:"filters"`
+	filter     *compiledFilter
+}
+
+func (r *repositoryConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&r.Name); err == nil {
+		return nil
+	}
+
+	type plain repositoryConfig
+	return unmarshal((*plain)(r))
 }
 
 func newRepositoryFinder() *Repositories {
@@ -20,17 +49,79 @@ func (r *Repositories) locateIn(path string) *Repositories {
 	return r
 }
 
-func (r *Repositories) registryList() *Repositories {
+func (r *Repositories) registryList() (*Repositories, error) {
 	data := &Repositories{}
 
 	b, err := os.ReadFile(r.Path)
 	if err != nil {
-		panic(err)
+		return nil, configErr(err)
 	}
 
 	if err := yaml.Unmarshal(b, data); err != nil {
-		panic(err)
+		return nil, configErr(err)
+	}
+
+	if data.Discover != "" && data.Discover != discoverAll {
+		return nil, configErr(fmt.Errorf("unknown discover value %q, expected %q", data.Discover, discoverAll))
+	}
+
+	if err := data.Naming.compile(); err != nil {
+		return nil, configErr(err)
+	}
+
+	data.filter, err = data.Filters.compile()
+	if err != nil {
+		return nil, configErr(err)
+	}
+
+	for i, entry := range data.Entries {
+		if err := validateConflictPolicy(entry.OnConflict); err != nil {
+			return nil, configErr(err)
+		}
+
+		if err := validateLifecyclePolicy(entry.Lifecycle); err != nil {
+			return nil, configErr(err)
+		}
+
+		if data.Entries[i].filter, err = entry.Filters.compile(); err != nil {
+			return nil, configErr(fmt.Errorf("%s: %w", entry.Name, err))
+		}
+	}
+
+	data.resolve(nil)
+	return data, nil
+}
+
+func (r *Repositories) tagFilters() tagFilters {
+	filters := tagFilters{
+		global:       r.filter,
+		repositories: make(map[string]*compiledFilter, len(r.List)),
 	}
 
-	return data
+	for _, name := range r.List {
+		if entry, found := r.entryFor(name); found && entry.filter != nil {
+			filters.repositories[name] = entry.filter
+		}
+	}
+	return filters
+}
+
+func (r *Repositories) conflictPolicies() map[string]string {
+	policies := make(map[string]string, len(r.List))
+	for _, name := range r.List {
+		if entry, found := r.entryFor(name); found && entry.OnConflict != "" {
+			policies[name] = entry.OnConflict
+		}
+	}
+	return policies
+}
+
+func (r *Repositories) lifecyclePolicies() map[string]string {
+	policies := make(map[string]string, len(r.List))
+	for _, name := range r.List {
+		if entry, found := r.entryFor(name); found && entry.Lifecycle != "" {
+			policies[name] = entry.Lifecycle
+		}
+	}
+	return policies
 }
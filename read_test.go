@@ -16,6 +16,32 @@ func TestImageFinder(t *testing.T) {
 	}
 	defer os.Remove(fileName)
 
-	repositories := repoFinder.locateIn(fileName).registryList()
+	repositories, err := repoFinder.locateIn(fileName).registryList()
+	assert.NoError(t, err)
 	assert.Equal(t, repositories.List, repoList)
 }
+
+func TestRepositoryConfigEntries(t *testing.T) {
+	file, err := os.CreateTemp("", "file*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	config := `repositories:
+  - repo/test/app1
+  - name: repo/test/app2
+    on_conflict: skip
+`
+	if _, err := file.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	repositories, err := newRepositoryFinder().locateIn(file.Name()).registryList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"repo/test/app1", "repo/test/app2"}, repositories.List)
+	assert.Equal(t, map[string]string{"repo/test/app2": conflictSkip}, repositories.conflictPolicies())
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+const (
+	registryItemPolicy           = "registry policy"
+	registryItemReplication      = "replication"
+	registryItemPullThroughCache = "pull through cache"
+	registryItemScanning         = "scanning"
+	registryItemTemplates        = "creation template"
+)
+
+type registrySettings struct {
+	Policy            bool `yaml:"policy"`
+	Replication       bool `yaml:"replication"`
+	PullThroughCache  bool `yaml:"pull_through_cache"`
+	Scanning          bool `yaml:"scanning"`
+	CreationTemplates bool `yaml:"creation_templates"`
+}
+
+func (s registrySettings) empty() bool {
+	return !s.Policy && !s.Replication && !s.PullThroughCache && !s.Scanning && !s.CreationTemplates
+}
+
+type registryIssue struct {
+	item   string
+	name   string
+	reason string
+}
+
+type RegistryMigration struct {
+	source        *ECR
+	target        *ECR
+	settings      registrySettings
+	targetAccount string
+	dryRun        bool
+	issues        []registryIssue
+	attempts      int
+	failures      []imageFailure
+}
+
+func newRegistryMigration(source, target *ECR) *RegistryMigration {
+	return &RegistryMigration{
+		source: source,
+		target: target,
+	}
+}
+
+func (r *RegistryMigration) withSettings(settings registrySettings) *RegistryMigration {
+	r.settings = settings
+	return r
+}
+
+func (r *RegistryMigration) withTargetAccount(account string) *RegistryMigration {
+	r.targetAccount = account
+	return r
+}
+
+func (r *RegistryMigration) withDryRun(dryRun bool) *RegistryMigration {
+	r.dryRun = dryRun
+	return r
+}
+
+func (r *RegistryMigration) issue(item, name, reason string) {
+	r.issues = append(r.issues, registryIssue{item: item, name: name, reason: reason})
+}
+
+func (r *RegistryMigration) failed(item, name string, err error) {
+	r.failures = append(r.failures, imageFailure{repository: item, reference: name, err: err})
+}
+
+func (r *RegistryMigration) applied(item, name string) {
+	status := "applied"
+	if r.dryRun {
+		status = "would be applied"
+	}
+	slog.Info("registryMigration", "item", item, "name", name, "status", status)
+}
+
+func (r *RegistryMigration) migrate() ([]registryIssue, error) {
+	if r.settings.empty() {
+		return nil, configErr(errors.New("the registry section of the config file does not enable any setting"))
+	}
+
+	steps := []struct {
+		enabled bool
+		item    string
+		run     func() error
+	}{
+		{r.settings.Policy, registryItemPolicy, r.migratePolicy},
+		{r.settings.Replication, registryItemReplication, r.migrateReplication},
+		{r.settings.PullThroughCache, registryItemPullThroughCache, r.migratePullThroughCache},
+		{r.settings.Scanning, registryItemScanning, r.migrateScanning},
+		{r.settings.CreationTemplates, registryItemTemplates, r.migrateCreationTemplates},
+	}
+
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+		r.attempts++
+		if err := step.run(); err != nil {
+			r.failed(step.item, "", err)
+		}
+	}
+
+	return r.issues, r.err()
+}
+
+func (r *RegistryMigration) err() error {
+	if len(r.failures) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(r.failures)+1)
+	for _, failure := range r.failures {
+		slog.Error("registryFailure", "item", failure.repository, "name", failure.reference, "error", failure.err)
+
+		errs = append(errs, fmt.Errorf("%s %s: %w", failure.repository, failure.reference, failure.err))
+	}
+
+	errs = append(errs, &migrationError{unit: "registry settings", total: r.attempts, failures: r.failures})
+	return errors.Join(errs...)
+}
+
+func (r *RegistryMigration) migratePolicy() error {
+	resp, err := r.source.ecr.GetRegistryPolicy(r.source.ctx, &ecr.GetRegistryPolicyInput{})
+	if err != nil {
+		var notFoundErr *types.RegistryPolicyNotFoundException
+		if errors.As(err, &notFoundErr) {
+			slog.Info("registryMigration", "item", registryItemPolicy, "status", "not set in the source")
+			return nil
+		}
+		return err
+	}
+
+	policy, err := r.target.policyRewrite.rewrite(registryItemPolicy, aws.ToString(resp.PolicyText))
+	if err != nil {
+		return err
+	}
+	if policy == "" {
+		r.issue(registryItemPolicy, "", "no statement left after removing unknown principals")
+		return nil
+	}
+
+	if !r.dryRun {
+		if _, err := r.target.ecr.PutRegistryPolicy(r.target.ctx, &ecr.PutRegistryPolicyInput{
+			PolicyText: aws.String(policy),
+		}); err != nil {
+			return err
+		}
+	}
+
+	r.applied(registryItemPolicy, "")
+	return nil
+}
+
+func (r *RegistryMigration) migrateReplication() error {
+	resp, err := r.source.ecr.DescribeRegistry(r.source.ctx, &ecr.DescribeRegistryInput{})
+	if err != nil {
+		return err
+	}
+
+	if resp.ReplicationConfiguration == nil || len(resp.ReplicationConfiguration.Rules) == 0 {
+		slog.Info("registryMigration", "item", registryItemReplication, "status", "not set in the source")
+		return nil
+	}
+
+	targetRegion := r.target.ecr.Options().Region
+	rules := make([]types.ReplicationRule, 0, len(resp.ReplicationConfiguration.Rules))
+	for _, rule := range resp.ReplicationConfiguration.Rules {
+		destinations := make([]types.ReplicationDestination, 0, len(rule.Destinations))
+		for _, destination := range rule.Destinations {
+			name := aws.ToString(destination.RegistryId) + "/" + aws.ToString(destination.Region)
+			registryID := r.target.policyRewrite.rewriteString(aws.ToString(destination.RegistryId))
+
+			if registryID == r.targetAccount && aws.ToString(destination.Region) == targetRegion {
+				r.issue(registryItemReplication, name, "destination is the target registry itself, dropped")
+				continue
+			}
+
+			destinations = append(destinations, types.ReplicationDestination{
+				RegistryId: aws.String(registryID),
+				Region:     destination.Region,
+			})
+		}
+
+		if len(destinations) > 0 {
+			rule.Destinations = destinations
+			rules = append(rules, rule)
+		}
+	}
+
+	if len(rules) == 0 {
+		r.issue(registryItemReplication, "", "no rule left after translation")
+		return nil
+	}
+
+	if !r.dryRun {
+		if _, err := r.target.ecr.PutReplicationConfiguration(r.target.ctx, &ecr.PutReplicationConfigurationInput{
+			ReplicationConfiguration: &types.ReplicationConfiguration{Rules: rules},
+		}); err != nil {
+			return err
+		}
+	}
+
+	r.applied(registryItemReplication, fmt.Sprintf("%d rules", len(rules)))
+	return nil
+}
+
+func (r *RegistryMigration) migratePullThroughCache() error {
+	paginator := ecr.NewDescribePullThroughCacheRulesPaginator(r.source.ecr, &ecr.DescribePullThroughCacheRulesInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(r.source.ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range resp.PullThroughCacheRules {
+			prefix := aws.ToString(rule.EcrRepositoryPrefix)
+			input := &ecr.CreatePullThroughCacheRuleInput{
+				EcrRepositoryPrefix: rule.EcrRepositoryPrefix,
+				UpstreamRegistryUrl: rule.UpstreamRegistryUrl,
+				UpstreamRegistry:    rule.UpstreamRegistry,
+			}
+
+			if credential := aws.ToString(rule.CredentialArn); credential != "" {
+				rewritten := r.target.policyRewrite.rewriteString(credential)
+				if rewritten == credential {
+					r.issue(registryItemPullThroughCache, prefix, "credential secret "+credential+" belongs to the source account and has no account mapping, skipped")
+					continue
+				}
+				input.CredentialArn = aws.String(rewritten)
+			}
+
+			if r.dryRun {
+				r.applied(registryItemPullThroughCache, prefix)
+				continue
+			}
+
+			if _, err := r.target.ecr.CreatePullThroughCacheRule(r.target.ctx, input); err != nil {
+				var alreadyExistsErr *types.PullThroughCacheRuleAlreadyExistsException
+				if errors.As(err, &alreadyExistsErr) {
+					slog.Info("registryMigration", "item", registryItemPullThroughCache, "name", prefix, "status", "already exists")
+					continue
+				}
+				r.attempts++
+				r.failed(registryItemPullThroughCache, prefix, err)
+				continue
+			}
+			r.applied(registryItemPullThroughCache, prefix)
+		}
+	}
+
+	return nil
+}
+
+func (r *RegistryMigration) migrateScanning() error {
+	resp, err := r.source.ecr.GetRegistryScanningConfiguration(r.source.ctx, &ecr.GetRegistryScanningConfigurationInput{})
+	if err != nil {
+		return err
+	}
+
+	if resp.ScanningConfiguration == nil {
+		slog.Info("registryMigration", "item", registryItemScanning, "status", "not set in the source")
+		return nil
+	}
+
+	if !r.dryRun {
+		if _, err := r.target.ecr.PutRegistryScanningConfiguration(r.target.ctx, &ecr.PutRegistryScanningConfigurationInput{
+			ScanType: resp.ScanningConfiguration.ScanType,
+			Rules:    resp.ScanningConfiguration.Rules,
+		}); err != nil {
+			return err
+		}
+	}
+
+	r.applied(registryItemScanning, string(resp.ScanningConfiguration.ScanType))
+	return nil
+}
+
+func (r *RegistryMigration) migrateCreationTemplates() error {
+	paginator := ecr.NewDescribeRepositoryCreationTemplatesPaginator(r.source.ecr, &ecr.DescribeRepositoryCreationTemplatesInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(r.source.ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, template := range resp.RepositoryCreationTemplates {
+			prefix := aws.ToString(template.Prefix)
+			input, err := r.creationTemplateInput(template)
+			if err != nil {
+				r.issue(registryItemTemplates, prefix, err.Error())
+				continue
+			}
+
+			if r.dryRun {
+				r.applied(registryItemTemplates, prefix)
+				continue
+			}
+
+			if _, err := r.target.ecr.CreateRepositoryCreationTemplate(r.target.ctx, input); err != nil {
+				var alreadyExistsErr *types.TemplateAlreadyExistsException
+				if errors.As(err, &alreadyExistsErr) {
+					slog.Info("registryMigration", "item", registryItemTemplates, "name", prefix, "status", "already exists")
+					continue
+				}
+				r.attempts++
+				r.failed(registryItemTemplates, prefix, err)
+				continue
+			}
+			r.applied(registryItemTemplates, prefix)
+		}
+	}
+
+	return nil
+}
+
+func (r *RegistryMigration) creationTemplateInput(template types.RepositoryCreationTemplate) (*ecr.CreateRepositoryCreationTemplateInput, error) {
+	prefix := aws.ToString(template.Prefix)
+	input := &ecr.CreateRepositoryCreationTemplateInput{
+		Prefix:             template.Prefix,
+		AppliedFor:         template.AppliedFor,
+		Description:        template.Description,
+		ImageTagMutability: template.ImageTagMutability,
+		LifecyclePolicy:    template.LifecyclePolicy,
+		ResourceTags:       template.ResourceTags,
+	}
+
+	if policy := aws.ToString(template.RepositoryPolicy); policy != "" {
+		rewritten, err := r.target.policyRewrite.rewrite(prefix, policy)
+		if err != nil {
+			return nil, err
+		}
+		if rewritten == "" {
+			r.issue(registryItemTemplates, prefix, "repository policy has no statement left after removing unknown principals, policy dropped")
+		} else {
+			input.RepositoryPolicy = aws.String(rewritten)
+		}
+	}
+
+	if role := aws.ToString(template.CustomRoleArn); role != "" {
+		rewritten := r.target.policyRewrite.rewriteString(role)
+		if rewritten == role {
+			r.issue(registryItemTemplates, prefix, "custom role "+role+" belongs to the source account and has no account mapping, role dropped")
+		} else {
+			input.CustomRoleArn = aws.String(rewritten)
+		}
+	}
+
+	if encryption := template.EncryptionConfiguration; encryption != nil {
+		mapped := r.target.targetEncryption(prefix, &types.EncryptionConfiguration{
+			EncryptionType: encryption.EncryptionType,
+			KmsKey:         encryption.KmsKey,
+		})
+		input.EncryptionConfiguration = &types.EncryptionConfigurationForRepositoryCreationTemplate{
+			EncryptionType: mapped.EncryptionType,
+			KmsKey:         mapped.KmsKey,
+		}
+	}
+
+	return input, nil
+}
+
+func reportRegistryIssues(issues []registryIssue) {
+	for _, issue := range issues {
+		slog.Warn("registryIssue", "item", issue.item, "name", issue.name, "reason", issue.reason)
+	}
+	slog.Info("registryMigration", "issues", len(issues), "status", "finished")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryMigration(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.settings["GetRegistryPolicy"] = map[string]string{
+		"registryId": "111111111111",
+		"policyText": `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:root"},"Action":"ecr:ReplicateImage"}]}`,
+	}
+	sourceRegistry.settings["DescribeRegistry"] = map[string]any{
+		"registryId": "111111111111",
+		"replicationConfiguration": map[string]any{"rules": []map[string]any{{
+			"destinations": []map[string]string{
+				{"region": "us-east-1", "registryId": "111111111111"},
+				{"region": "eu-west-1", "registryId": "111111111111"},
+			},
+		}}},
+	}
+	sourceRegistry.settings["DescribePullThroughCacheRules"] = map[string]any{"pullThroughCacheRules": []map[string]string{
+		{"ecrRepositoryPrefix": "ecr-public", "upstreamRegistryUrl": "public.ecr.aws"},
+		{"ecrRepositoryPrefix": "docker-hub", "upstreamRegistryUrl": "registry-1.docker.io", "credentialArn": "arn:aws:secretsmanager:us-east-1:111111111111:secret:ecr-pullthroughcache/hub"},
+		{"ecrRepositoryPrefix": "ghcr", "upstreamRegistryUrl": "ghcr.io", "credentialArn": "arn:aws:secretsmanager:us-east-1:333333333333:secret:ecr-pullthroughcache/ghcr"},
+	}}
+	sourceRegistry.settings["GetRegistryScanningConfiguration"] = map[string]any{
+		"registryId":            "111111111111",
+		"scanningConfiguration": map[string]any{"scanType": "ENHANCED", "rules": []map[string]any{{"scanFrequency": "SCAN_ON_PUSH", "repositoryFilters": []map[string]string{{"filter": "*", "filterType": "WILDCARD"}}}}},
+	}
+	sourceRegistry.settings["DescribeRepositoryCreationTemplates"] = map[string]any{"repositoryCreationTemplates": []map[string]any{{
+		"prefix":                  "team-a",
+		"appliedFor":              []string{"PULL_THROUGH_CACHE"},
+		"customRoleArn":           "arn:aws:iam::444444444444:role/templates",
+		"encryptionConfiguration": map[string]string{"encryptionType": "KMS", "kmsKey": "arn:aws:kms:us-east-1:111111111111:key/source"},
+	}}}
+
+	target := targetRegistry.client().
+		withKmsKeys(map[string]string{"arn:aws:kms:us-east-1:111111111111:key/source": "arn:aws:kms:us-east-1:222222222222:key/target"}).
+		withPolicyRewrite(policyRewrite{Accounts: map[string]string{"111111111111": "222222222222"}})
+
+	issues, err := newRegistryMigration(sourceRegistry.client(), target).
+		withSettings(registrySettings{Policy: true, Replication: true, PullThroughCache: true, Scanning: true, CreationTemplates: true}).
+		withTargetAccount("222222222222").
+		migrate()
+	assert.NoError(t, err)
+
+	items := make([]string, len(issues))
+	for i, issue := range issues {
+		items[i] = issue.item + " " + issue.name
+	}
+	assert.ElementsMatch(t, []string{
+		registryItemReplication + " 111111111111/us-east-1",
+		registryItemPullThroughCache + " ghcr",
+		registryItemTemplates + " team-a",
+	}, items)
+
+	writes := targetRegistry.writes
+	if assert.Len(t, writes["PutRegistryPolicy"], 1) {
+		assert.Contains(t, string(writes["PutRegistryPolicy"][0]), "arn:aws:iam::222222222222:root")
+	}
+
+	if assert.Len(t, writes["PutReplicationConfiguration"], 1) {
+		var replication struct {
+			ReplicationConfiguration struct {
+				Rules []struct {
+					Destinations []map[string]string
+				}
+			}
+		}
+		assert.NoError(t, json.Unmarshal(writes["PutReplicationConfiguration"][0], &replication))
+		assert.Equal(t, []map[string]string{{"region": "eu-west-1", "registryId": "222222222222"}}, replication.ReplicationConfiguration.Rules[0].Destinations)
+	}
+
+	if assert.Len(t, writes["CreatePullThroughCacheRule"], 2) {
+		assert.Contains(t, string(writes["CreatePullThroughCacheRule"][1]), "arn:aws:secretsmanager:us-east-1:222222222222:secret:ecr-pullthroughcache/hub")
+	}
+
+	if assert.Len(t, writes["PutRegistryScanningConfiguration"], 1) {
+		assert.Contains(t, string(writes["PutRegistryScanningConfiguration"][0]), `"scanType":"ENHANCED"`)
+	}
+
+	if assert.Len(t, writes["CreateRepositoryCreationTemplate"], 1) {
+		template := string(writes["CreateRepositoryCreationTemplate"][0])
+		assert.Contains(t, template, "arn:aws:kms:us-east-1:222222222222:key/target")
+		assert.NotContains(t, template, "customRoleArn")
+	}
+}
+
+func TestRegistryMigrationDryRun(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.settings["GetRegistryScanningConfiguration"] = map[string]any{
+		"scanningConfiguration": map[string]any{"scanType": "BASIC"},
+	}
+
+	issues, err := newRegistryMigration(sourceRegistry.client(), targetRegistry.client()).
+		withSettings(registrySettings{Policy: true, Scanning: true}).
+		withDryRun(true).
+		migrate()
+	assert.NoError(t, err)
+
+	assert.Empty(t, issues, "a missing registry policy is not an issue")
+	assert.Empty(t, targetRegistry.writes)
+
+	_, err = newRegistryMigration(sourceRegistry.client(), targetRegistry.client()).migrate()
+	assert.Equal(t, exitConfigError, exitCode(err), "expected an empty registry section to be a config error")
+}
+
+func TestRegistryMigrationFailures(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.settings["GetRegistryScanningConfiguration"] = map[string]any{
+		"scanningConfiguration": map[string]any{"scanType": "BASIC"},
+	}
+	sourceRegistry.settings["DescribePullThroughCacheRules"] = map[string]any{"pullThroughCacheRules": []map[string]string{
+		{"ecrRepositoryPrefix": "ecr-public", "upstreamRegistryUrl": "public.ecr.aws"},
+	}}
+	targetRegistry.errors["CreatePullThroughCacheRule"] = "LimitExceededException"
+
+	issues, err := newRegistryMigration(sourceRegistry.client(), targetRegistry.client()).
+		withSettings(registrySettings{Scanning: true, PullThroughCache: true}).
+		migrate()
+	assert.Empty(t, issues, "api failures are not translation issues")
+	assert.ErrorContains(t, err, "LimitExceededException")
+	assert.Equal(t, exitPartialFailed, exitCode(err))
+	assert.Len(t, targetRegistry.writes["PutRegistryScanningConfiguration"], 1)
+
+	targetRegistry.errors["PutRegistryScanningConfiguration"] = "AccessDeniedException"
+	_, err = newRegistryMigration(sourceRegistry.client(), targetRegistry.client()).
+		withSettings(registrySettings{Scanning: true}).
+		migrate()
+	assert.Equal(t, exitAuthError, exitCode(err))
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	outcomeCopied    = "copied"
+	outcomeFailed    = "failed"
+	outcomeCancelled = "cancelled"
+	outcomeMigrated  = "already migrated"
+	outcomeUpToDate  = "up to date"
+	outcomeConflict  = "conflict"
+
+	reportJSON  = ".json"
+	reportCSV   = ".csv"
+	reportJUnit = ".xml"
+)
+
+type reportEntry struct {
+	Repository     string  `json:"repository"`
+	Reference      string  `json:"reference"`
+	Source         string  `json:"source"`
+	Target         string  `json:"target"`
+	Digest         string  `json:"digest"`
+	TargetDigest   string  `json:"target_digest"`
+	Conflict       string  `json:"conflict,omitempty"`
+	ConflictDigest string  `json:"conflict_digest,omitempty"`
+	Size           int64   `json:"size"`
+	Duration       float64 `json:"duration_seconds"`
+	Attempts       int     `json:"attempts"`
+	Outcome        string  `json:"outcome"`
+	Error          string  `json:"error,omitempty"`
+}
+
+func newReportEntry(metadata repositoryMetadata, reference, from, to string) reportEntry {
+	entry := reportEntry{
+		Repository: metadata.repositoryName,
+		Reference:  reference,
+		Source:     from,
+		Target:     to,
+		Digest:     metadata.images[reference].digest,
+		Size:       metadata.images[reference].size,
+	}
+
+	if c, found := metadata.conflicts[reference]; found {
+		entry.Conflict = c.policy
+		entry.ConflictDigest = c.targetDigest
+	}
+	return entry
+}
+
+func (e reportEntry) finish(started time.Time, attempts int, err error) reportEntry {
+	e.Duration = time.Since(started).Seconds()
+	e.Attempts += attempts
+	e.Outcome = outcomeCopied
+	if err != nil {
+		e.Outcome = outcomeFailed
+		e.Error = err.Error()
+	}
+	return e
+}
+
+func (e reportEntry) pushed(digest string) reportEntry {
+	e.TargetDigest = digest
+	return e
+}
+
+func (e reportEntry) with(outcome string) reportEntry {
+	e.Outcome = outcome
+	return e
+}
+
+type migrationReport struct {
+	mu         sync.Mutex
+	started    time.Time
+	targetHost string
+	entries    []reportEntry
+}
+
+type reportDocument struct {
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Summary  map[string]int `json:"summary"`
+	Images   []reportEntry  `json:"images"`
+}
+
+func newMigrationReport() *migrationReport {
+	return &migrationReport{
+		started: time.Now().UTC(),
+	}
+}
+
+func (r *migrationReport) withTargetHost(host string) *migrationReport {
+	r.targetHost = host
+	return r
+}
+
+func (r *migrationReport) add(entry reportEntry) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+func (r *migrationReport) addSkipped(data metadataList) *migrationReport {
+	for _, metadata := range data.repoList {
+		for _, reference := range metadata.upToDate {
+			entry := r.entry(metadata, reference, reference)
+			entry.TargetDigest = entry.Digest
+			r.add(entry.with(outcomeUpToDate))
+		}
+	}
+
+	for _, c := range data.conflicts {
+		if c.policy != conflictSkip && c.policy != conflictFail {
+			continue
+		}
+
+		metadata := repositoryMetadata{repositoryName: c.repository}
+		for _, m := range data.repoList {
+			if m.repositoryName == c.repository {
+				metadata = m
+				break
+			}
+		}
+
+		entry := r.entry(metadata, c.reference, c.reference)
+		entry.Digest = c.sourceDigest
+		entry.TargetDigest = c.targetDigest
+		entry.Conflict = c.policy
+		entry.ConflictDigest = c.targetDigest
+		entry.Outcome = outcomeConflict
+		entry.Error = fmt.Sprintf("target %s points at %s, on_conflict is %s", c.reference, c.targetDigest, c.policy)
+		r.add(entry)
+	}
+	return r
+}
+
+func (r *migrationReport) addFailed(metadata repositoryMetadata, references []string, err error) {
+	if r == nil {
+		return
+	}
+
+	for _, reference := range references {
+		r.add(r.entry(metadata, reference, metadata.targetReference(reference)).finish(time.Now(), 0, err))
+	}
+}
+
+func (r *migrationReport) entry(metadata repositoryMetadata, reference, targetReference string) reportEntry {
+	return newReportEntry(
+		metadata,
+		reference,
+		metadata.repositoryURI+referenceSeparator(reference)+reference,
+		r.targetHost+"/"+metadata.targetRepository()+referenceSeparator(targetReference)+targetReference,
+	)
+}
+
+func (r *migrationReport) document() reportDocument {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := make([]reportEntry, len(r.entries))
+	copy(images, r.entries)
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].Repository != images[j].Repository {
+			return images[i].Repository < images[j].Repository
+		}
+		return images[i].Reference < images[j].Reference
+	})
+
+	summary := make(map[string]int)
+	for _, image := range images {
+		summary[image.Outcome]++
+	}
+
+	return reportDocument{
+		Started:  r.started,
+		Finished: time.Now().UTC(),
+		Summary:  summary,
+		Images:   images,
+	}
+}
+
+func (r *migrationReport) write(paths []string) error {
+	if r == nil {
+		return nil
+	}
+
+	doc := r.document()
+	conflicts := 0
+	for _, image := range doc.Images {
+		if image.Conflict != "" {
+			conflicts++
+		}
+	}
+
+	slog.Info("migrationReport",
+		"images", len(doc.Images),
+		outcomeCopied, doc.Summary[outcomeCopied],
+		outcomeFailed, doc.Summary[outcomeFailed],
+		outcomeCancelled, doc.Summary[outcomeCancelled],
+		"alreadyMigrated", doc.Summary[outcomeMigrated],
+		"upToDate", doc.Summary[outcomeUpToDate],
+		"conflicts", conflicts,
+	)
+
+	var errs []error
+	for _, path := range paths {
+		if err := doc.writeFile(path); err != nil {
+			errs = append(errs, fmt.Errorf("report %s: %w", path, err))
+			continue
+		}
+		slog.Info("migrationReport", "path", path, "status", "written")
+	}
+	return errors.Join(errs...)
+}
+
+func (d reportDocument) writeFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := d.encode(file, filepath.Ext(path)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (d reportDocument) encode(w io.Writer, format string) error {
+	switch format {
+	case reportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d)
+	case reportCSV:
+		return d.encodeCSV(w)
+	case reportJUnit:
+		return d.encodeJUnit(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func (d reportDocument) encodeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"repository", "reference", "source", "target", "digest", "target_digest", "conflict", "conflict_digest", "size", "duration_seconds", "attempts", "outcome", "error"}); err != nil {
+		return err
+	}
+
+	for _, image := range d.Images {
+		if err := writer.Write([]string{
+			image.Repository,
+			image.Reference,
+			image.Source,
+			image.Target,
+			image.Digest,
+			image.TargetDigest,
+			image.Conflict,
+			image.ConflictDigest,
+			strconv.FormatInt(image.Size, 10),
+			strconv.FormatFloat(image.Duration, 'f', 3, 64),
+			strconv.Itoa(image.Attempts),
+			image.Outcome,
+			image.Error,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (d reportDocument) encodeJUnit(w io.Writer) error {
+	suites := junitTestSuites{
+		Name: "ecr-migrate",
+		Time: junitTime(d.Finished.Sub(d.Started).Seconds()),
+	}
+
+	index := make(map[string]int)
+	durations := make(map[string]float64)
+	for _, image := range d.Images {
+		i, found := index[image.Repository]
+		if !found {
+			i = len(suites.Suites)
+			index[image.Repository] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: image.Repository})
+		}
+		suite := &suites.Suites[i]
+
+		testCase := junitTestCase{
+			Name:      image.Reference,
+			Classname: image.Repository,
+			Time:      junitTime(image.Duration),
+			SystemOut: fmt.Sprintf("%s -> %s (%s, %d bytes, %d attempts): %s", image.Source, image.Target, image.Digest, image.Size, image.Attempts, image.Outcome),
+		}
+		if image.Conflict != "" {
+			testCase.SystemOut += fmt.Sprintf(", conflict with %s resolved by %s", image.ConflictDigest, image.Conflict)
+		}
+
+		switch image.Outcome {
+		case outcomeFailed:
+			testCase.Failure = &junitMessage{Message: image.Outcome, Text: image.Error}
+			suite.Failures++
+		case outcomeCancelled, outcomeConflict:
+			testCase.Skipped = &junitMessage{Message: strings.TrimSpace(image.Outcome + " " + image.Error)}
+			suite.Skipped++
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		durations[image.Repository] += image.Duration
+	}
+
+	for i := range suites.Suites {
+		suite := &suites.Suites[i]
+		suite.Time = junitTime(durations[suite.Name])
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+func parseReportPaths(value string) ([]string, error) {
+	return parseOutputPaths(value, reportJSON, reportCSV, reportJUnit)
+}
+
+func parseOutputPaths(value string, extensions ...string) ([]string, error) {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if !slices.Contains(extensions, filepath.Ext(path)) {
+			return nil, fmt.Errorf("unknown format for %q, expected a file ending in %s", path, strings.Join(extensions, ", "))
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
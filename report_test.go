@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReportPaths(t *testing.T) {
+	paths, err := parseReportPaths("report.json, out/report.xml,report.csv,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"report.json", "out/report.xml", "report.csv"}, paths)
+
+	paths, err = parseReportPaths("")
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+
+	_, err = parseReportPaths("report.txt")
+	assert.Error(t, err)
+}
+
+func TestTransferReport(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-shared"))
+	sourceRegistry.addImage("repo/test/app1", []string{"2.0"}, []byte("layer-new"))
+	sourceRegistry.addImage("repo/test/app1", []string{"3.0"}, []byte("layer-same"))
+	sourceRegistry.addImage("repo/test/skip", []string{"1.0"}, []byte("layer-1.0"))
+	targetRegistry.addImage("repo/test/app1", []string{"0.9"}, []byte("layer-shared"))
+	targetRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-shared"), []byte("layer-old"))
+	targetRegistry.addImage("repo/test/app1", []string{"3.0"}, []byte("layer-same"))
+	targetRegistry.addImage("repo/test/skip", []string{"1.0"}, []byte("layer-1.0-changed"))
+
+	source, target := sourceRegistry.client(), targetRegistry.client()
+	policy := newConflictPolicy(conflictOverwrite, "", map[string]string{"repo/test/skip": conflictSkip})
+	metadata := mustReconcile(t, source, target, mustWalk(t, source, []string{"repo/test/app1", "repo/test/skip"}), policy)
+
+	report := newMigrationReport().withTargetHost(targetRegistry.host).addSkipped(metadata)
+	err := newTransfer().
+		withSource(source).
+		withTarget(target).
+		withReport(report).
+		addMetadataList(metadata).
+		withArgs(&Args{engine: engineECR, copiers: 1}).
+		migrate()
+	assert.Error(t, err)
+	assert.Zero(t, targetRegistry.calls["GetRepositoryPolicy"], "expected only the repository uris to be looked up in the target")
+	assert.Zero(t, targetRegistry.calls["ListTagsForResource"])
+
+	doc := report.document()
+	assert.Equal(t, map[string]int{outcomeCopied: 1, outcomeFailed: 1, outcomeUpToDate: 1, outcomeConflict: 1}, doc.Summary)
+
+	outcomes := make(map[string]reportEntry)
+	for _, image := range doc.Images {
+		outcomes[image.Repository+":"+image.Reference] = image
+	}
+
+	copied := outcomes["repo/test/app1:1.0"]
+	assert.Equal(t, outcomeCopied, copied.Outcome)
+	assert.NotEmpty(t, copied.TargetDigest)
+	assert.Equal(t, sourceRegistry.image("repo/test/app1", "1.0").digest, copied.Digest)
+	assert.NotZero(t, copied.Size)
+	assert.Equal(t, 1, copied.Attempts)
+	assert.Equal(t, copied.Digest, copied.TargetDigest, "expected the digest returned by the push")
+	assert.Contains(t, copied.Target, targetRegistry.host+"/repo/test/app1:1.0")
+	assert.Equal(t, conflictOverwrite, copied.Conflict, "expected the overwritten tag to be marked as a conflict")
+	assert.NotEmpty(t, copied.ConflictDigest)
+	assert.NotEqual(t, copied.Digest, copied.ConflictDigest)
+
+	failed := outcomes["repo/test/app1:2.0"]
+	assert.Equal(t, outcomeFailed, failed.Outcome)
+	assert.NotEmpty(t, failed.Error)
+
+	assert.Empty(t, failed.TargetDigest, "expected no target digest without a push")
+
+	assert.Equal(t, outcomeUpToDate, outcomes["repo/test/app1:3.0"].Outcome)
+	assert.Equal(t, outcomes["repo/test/app1:3.0"].Digest, outcomes["repo/test/app1:3.0"].TargetDigest)
+	assert.Equal(t, targetRegistry.host+"/repo/test/app1:3.0", outcomes["repo/test/app1:3.0"].Target)
+	assert.Equal(t, outcomeConflict, outcomes["repo/test/skip:1.0"].Outcome)
+	assert.Contains(t, outcomes["repo/test/skip:1.0"].Error, conflictSkip)
+	assert.Equal(t, conflictSkip, outcomes["repo/test/skip:1.0"].Conflict)
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "report.json"), filepath.Join(dir, "report.csv"), filepath.Join(dir, "report.xml")}
+	assert.NoError(t, report.write(paths))
+
+	b, err := os.ReadFile(paths[0])
+	assert.NoError(t, err)
+	var written reportDocument
+	assert.NoError(t, json.Unmarshal(b, &written))
+	assert.Len(t, written.Images, 4)
+	assert.Equal(t, doc.Summary, written.Summary)
+
+	b, err = os.ReadFile(paths[1])
+	assert.NoError(t, err)
+	rows, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 5) {
+		assert.Equal(t, "repository", rows[0][0])
+		assert.Equal(t, []string{"repo/test/app1", "1.0"}, rows[1][:2])
+	}
+
+	b, err = os.ReadFile(paths[2])
+	assert.NoError(t, err)
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(b, &suites))
+	assert.Equal(t, 4, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Equal(t, 1, suites.Skipped)
+	if assert.Len(t, suites.Suites, 2) {
+		assert.Equal(t, "repo/test/app1", suites.Suites[0].Name)
+		assert.NotNil(t, suites.Suites[0].Cases[1].Failure)
+		assert.NotNil(t, suites.Suites[1].Cases[0].Skipped)
+	}
+}
+
+func TestTransferReportResume(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-shared"))
+	targetRegistry.addImage("repo/test/app1", []string{"0.9"}, []byte("layer-shared"))
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	run := func(resume bool) reportEntry {
+		checkpoint, err := loadCheckpoint(path, resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report := newMigrationReport().withTargetHost(targetRegistry.host)
+		err = newTransfer().
+			withSource(sourceRegistry.client()).
+			withTarget(targetRegistry.client()).
+			withCheckpoint(checkpoint).
+			withReport(report).
+			addMetadataList(mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1"})).
+			withArgs(&Args{engine: engineECR, copiers: 1}).
+			migrate()
+		assert.NoError(t, err)
+		assert.NoError(t, checkpoint.close())
+		return report.document().Images[0]
+	}
+
+	copied := run(false)
+	assert.Equal(t, outcomeCopied, copied.Outcome)
+	assert.NotEmpty(t, copied.TargetDigest)
+
+	resumed := run(true)
+	assert.Equal(t, outcomeMigrated, resumed.Outcome)
+	assert.Equal(t, copied.TargetDigest, resumed.TargetDigest, "expected the digest recorded in the checkpoint")
+}
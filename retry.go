@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	defaultRetryAttempts  = 5
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = 30 * time.Second
+
+	retryOperationAPI = "ecrApi"
+)
+
+var (
+	throttlingCodes = []string{
+		"ThrottlingException",
+		"ThrottledException",
+		"TooManyRequestsException",
+		"RequestLimitExceeded",
+		"RequestThrottled",
+		"RequestThrottledException",
+		"SlowDown",
+	}
+
+	expiredTokenCodes = []string{
+		"ExpiredToken",
+		"ExpiredTokenException",
+		"RequestExpired",
+	}
+
+	retryableMessages = []string{
+		"toomanyrequests",
+		"too many requests",
+		"rate exceeded",
+		"connection reset",
+		"broken pipe",
+		"unexpected eof",
+		"i/o timeout",
+		"tls handshake timeout",
+		"internal server error",
+		"bad gateway",
+		"service unavailable",
+		"gateway timeout",
+	}
+)
+
+type retrySettings struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	BaseDelay   time.Duration `yaml:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay"`
+}
+
+type retryPolicy struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	attempts int
+	base     time.Duration
+	max      time.Duration
+	sleep    func(time.Duration)
+	jitter   func(time.Duration) time.Duration
+	retries  map[string]int
+}
+
+func newRetryPolicy(settings ...retrySettings) *retryPolicy {
+	p := &retryPolicy{
+		ctx:      context.Background(),
+		attempts: defaultRetryAttempts,
+		base:     defaultRetryBaseDelay,
+		max:      defaultRetryMaxDelay,
+		jitter:   rand.N[time.Duration],
+		retries:  make(map[string]int),
+	}
+	p.sleep = p.wait
+
+	for i := len(settings) - 1; i >= 0; i-- {
+		if settings[i].MaxAttempts > 0 {
+			p.attempts = settings[i].MaxAttempts
+		}
+		if settings[i].BaseDelay > 0 {
+			p.base = settings[i].BaseDelay
+		}
+		if settings[i].MaxDelay > 0 {
+			p.max = settings[i].MaxDelay
+		}
+	}
+
+	if p.max < p.base {
+		p.max = p.base
+	}
+	return p
+}
+
+func (p *retryPolicy) withContext(ctx context.Context) *retryPolicy {
+	p.ctx = ctx
+	return p
+}
+
+func (p *retryPolicy) wait(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-p.ctx.Done():
+	}
+}
+
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.max
+	if shift := attempt - 1; shift >= 0 && shift < 32 {
+		if d := p.base << shift; d > 0 && d < p.max {
+			delay = d
+		}
+	}
+
+	half := delay / 2
+	return half + p.jitter(delay-half+1)
+}
+
+func (p *retryPolicy) do(operation string, fn func() error) error {
+	_, err := p.run(operation, fn)
+	return err
+}
+
+func (p *retryPolicy) run(operation string, fn func() error) (int, error) {
+	attempts := 0
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		var exhausted *retry.MaxAttemptsError
+		if errors.As(err, &exhausted) {
+			attempts += exhausted.Attempt
+			return attempts, err
+		}
+
+		attempts++
+		if err == nil || attempt >= p.attempts || p.ctx.Err() != nil || !retryable(err) {
+			return attempts, err
+		}
+
+		delay := p.backoff(attempt)
+		p.retried(operation, attempt, delay, err)
+		p.sleep(delay)
+	}
+}
+
+func (p *retryPolicy) retried(operation string, attempt int, delay time.Duration, err error) {
+	p.mu.Lock()
+	p.retries[operation]++
+	p.mu.Unlock()
+
+	slog.Warn("retry", "operation", operation, "attempt", attempt, "maxAttempts", p.attempts, "delay", delay, "error", err)
+}
+
+func (p *retryPolicy) count(operation string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.retries[operation]
+}
+
+func (p *retryPolicy) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	operations := make([]string, 0, len(p.retries))
+	total := 0
+	for operation, retries := range p.retries {
+		operations = append(operations, operation)
+		total += retries
+	}
+	sort.Strings(operations)
+
+	for _, operation := range operations {
+		slog.Info("retrySummary", "operation", operation, "retries", p.retries[operation])
+	}
+	slog.Info("retrySummary", "retries", total, "status", "done")
+}
+
+func (p *retryPolicy) IsErrorRetryable(err error) bool {
+	return retryable(err)
+}
+
+func (p *retryPolicy) MaxAttempts() int {
+	return p.attempts
+}
+
+func (p *retryPolicy) RetryDelay(attempt int, err error) (time.Duration, error) {
+	delay := p.backoff(attempt)
+	p.retried(retryOperationAPI, attempt, delay, err)
+	return delay, nil
+}
+
+func (p *retryPolicy) GetRetryToken(context.Context, error) (func(error) error, error) {
+	return releaseRetryToken, nil
+}
+
+func (p *retryPolicy) GetInitialToken() func(error) error {
+	return releaseRetryToken
+}
+
+func releaseRetryToken(error) error {
+	return nil
+}
+
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if expiredToken(err) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && slices.Contains(throttlingCodes, apiErr.ErrorCode()) {
+		return true
+	}
+
+	var responseErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &responseErr) && retryableStatus(responseErr.HTTPStatusCode()) {
+		return true
+	}
+
+	var distributionErr *distributionError
+	if errors.As(err, &distributionErr) {
+		return retryableStatus(distributionErr.statusCode)
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, retryableMessage := range retryableMessages {
+		if strings.Contains(message, retryableMessage) {
+			return true
+		}
+	}
+	return false
+}
+
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+func expiredToken(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && slices.Contains(expiredTokenCodes, apiErr.ErrorCode()) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "token has expired") || strings.Contains(message, "token is expired")
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "throttling", err: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}, retryable: true},
+		{name: "expired token", err: &smithy.GenericAPIError{Code: "ExpiredTokenException"}, retryable: true},
+		{name: "not found", err: &smithy.GenericAPIError{Code: "RepositoryNotFoundException"}, retryable: false},
+		{name: "registry 503", err: &distributionError{statusCode: 503}, retryable: true},
+		{name: "registry 429", err: &distributionError{statusCode: 429}, retryable: true},
+		{name: "registry 404", err: &distributionError{statusCode: 404}, retryable: false},
+		{name: "registry expired token", err: &distributionError{statusCode: 401, body: "Your authorization token has expired. Reauthenticate and try again."}, retryable: true},
+		{name: "registry denied", err: &distributionError{statusCode: 401, body: "not authorized"}, retryable: false},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), retryable: true},
+		{name: "docker throttling", err: errors.New("toomanyrequests: Rate exceeded"), retryable: true},
+		{name: "docker 5xx", err: errors.New("received unexpected HTTP status: 503 Service Unavailable"), retryable: true},
+		{name: "config", err: configErr(errors.New("unknown engine")), retryable: false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.retryable, retryable(test.err), test.name)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var delays []time.Duration
+	policy := newRetryPolicy(retrySettings{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 4 * time.Second})
+	policy.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	calls := 0
+	err := policy.do("imageCopying", func() error {
+		calls++
+		if calls < 3 {
+			return &distributionError{statusCode: 502}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, policy.count("imageCopying"))
+	assert.Len(t, delays, 2)
+
+	calls = 0
+	err = policy.do("imageCopying", func() error {
+		calls++
+		return &distributionError{statusCode: 503}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls, "expected the policy to give up after max attempts")
+
+	calls = 0
+	err = policy.do("imagePulling", func() error {
+		calls++
+		return &distributionError{statusCode: 404}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "expected non retryable errors to fail immediately")
+	assert.Zero(t, policy.count("imagePulling"))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := newRetryPolicy(retrySettings{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 60: 10 * time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(attempt)
+			assert.GreaterOrEqual(t, delay, expected/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, delay, expected, "attempt %d", attempt)
+		}
+	}
+}
+
+func TestRetrySettings(t *testing.T) {
+	repositories := createTempConfig(t, `
+repositories:
+  - name: app
+retry:
+  max_attempts: 8
+  base_delay: 2s
+  max_delay: 1m
+`)
+
+	policy := newRetryPolicy(retrySettings{MaxAttempts: 3}, repositories.Retry)
+	assert.Equal(t, 3, policy.attempts, "expected flags to override the config file")
+	assert.Equal(t, 2*time.Second, policy.base)
+	assert.Equal(t, time.Minute, policy.max)
+
+	policy = newRetryPolicy(retrySettings{})
+	assert.Equal(t, defaultRetryAttempts, policy.attempts)
+	assert.Equal(t, defaultRetryBaseDelay, policy.base)
+	assert.Equal(t, defaultRetryMaxDelay, policy.max)
+}
+
+func TestEcrRetry(t *testing.T) {
+	source := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer source.server.Close()
+
+	source.addImage("app", []string{"1.0"}, []byte("layer"))
+	source.throttle["ListImages"] = 2
+
+	policy := newRetryPolicy(retrySettings{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	data := mustWalk(t, source.clientWith(policy), []string{"app"})
+
+	assert.Len(t, data.repoList, 1)
+	assert.Equal(t, []string{"1.0"}, data.repoList[0].tags)
+	assert.Equal(t, 2, policy.count(retryOperationAPI))
+}
+
+func TestDistributionRetryExpiredToken(t *testing.T) {
+	ecrSource := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer ecrSource.server.Close()
+
+	authSource := authorization{username: "AWS", password: ecrSource.host}
+	authTarget := authorization{username: "AWS", password: "target"}
+
+	sourceRegistry, sourceServer := newFakeRegistry(authSource)
+	defer sourceServer.Close()
+	sourceRegistry.denied = "Your authorization token has expired. Reauthenticate and try again."
+
+	targetRegistry, targetServer := newFakeRegistry(authTarget)
+	defer targetServer.Close()
+
+	if _, err := sourceRegistry.addImage("app", "1.0", []byte("layer")); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceURL, _ := url.Parse(sourceServer.URL)
+	targetURL, _ := url.Parse(targetServer.URL)
+
+	stale := authorization{username: "AWS", password: "stale", expiresAt: time.Now().Add(6 * time.Hour)}
+	distribution := newDistribution(newTokenProvider(ecrSource.client()).withToken(stale), authTarget)
+	distribution.http = sourceServer.Client()
+
+	policy := newRetryPolicy()
+	policy.sleep = func(time.Duration) {}
+
+	err := policy.do("imageCopying", func() error {
+		_, err := distribution.copy(copyImage{
+			from: sourceURL.Host + "/app:1.0",
+			to:   targetURL.Host + "/app:1.0",
+		})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, policy.count("imageCopying"))
+	assert.Equal(t, 1, ecrSource.calls["GetAuthorizationToken"], "expected the expired token to be refreshed")
+
+	_, found := targetRegistry.manifest("app", "1.0")
+	assert.True(t, found)
+}
+
+func TestTransferRetryBudget(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer"))
+
+	policy := newRetryPolicy(retrySettings{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	source := sourceRegistry.clientWith(policy)
+	metadata := mustWalk(t, source, []string{"repo/test/app1"})
+	sourceRegistry.throttle["BatchGetImage"] = 100
+
+	report := newMigrationReport()
+	err := newTransfer().
+		withSource(source).
+		withTarget(targetRegistry.client()).
+		withReport(report).
+		withRetry(policy).
+		addMetadataList(metadata).
+		withArgs(&Args{engine: engineECR, copiers: 1}).
+		migrate()
+	assert.Error(t, err)
+
+	assert.Equal(t, 3, sourceRegistry.calls["BatchGetImage"], "expected the sdk retries not to be repeated by the image retry")
+	assert.Equal(t, 3, report.document().Images[0].Attempts)
+}
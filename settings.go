@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+type repositorySettings struct {
+	arn           string
+	tagMutability types.ImageTagMutability
+	scanOnPush    bool
+	encryption    *types.EncryptionConfiguration
+	resourceTags  []types.Tag
+}
+
+func (e *ECR) pullSettings(repo types.Repository) repositorySettings {
+	settings := repositorySettings{
+		arn:           aws.ToString(repo.RepositoryArn),
+		tagMutability: repo.ImageTagMutability,
+		encryption:    repo.EncryptionConfiguration,
+	}
+
+	if repo.ImageScanningConfiguration != nil {
+		settings.scanOnPush = repo.ImageScanningConfiguration.ScanOnPush
+	}
+
+	if settings.arn == "" {
+		return settings
+	}
+
+	resp, err := e.ecr.ListTagsForResource(e.ctx, &ecr.ListTagsForResourceInput{
+		ResourceArn: repo.RepositoryArn,
+	})
+	if err != nil {
+		slog.Error("listTagsForResource", "error", err, "repository", aws.ToString(repo.RepositoryName))
+		return settings
+	}
+
+	settings.resourceTags = resp.Tags
+	return settings
+}
+
+func (e *ECR) targetEncryption(repository string, encryption *types.EncryptionConfiguration) *types.EncryptionConfiguration {
+	if encryption == nil || encryption.EncryptionType != types.EncryptionTypeKms || aws.ToString(encryption.KmsKey) == "" {
+		return encryption
+	}
+
+	if key, found := e.kmsKeys[aws.ToString(encryption.KmsKey)]; found {
+		return &types.EncryptionConfiguration{
+			EncryptionType: types.EncryptionTypeKms,
+			KmsKey:         aws.String(key),
+		}
+	}
+
+	slog.Warn("targetEncryption", "repository", repository, "kmsKey", aws.ToString(encryption.KmsKey), "status", "no kms key mapping, using the aws managed key")
+	return &types.EncryptionConfiguration{EncryptionType: types.EncryptionTypeKms}
+}
+
+func (e *ECR) createInput(metadata repositoryMetadata) *ecr.CreateRepositoryInput {
+	settings := metadata.settings
+	input := &ecr.CreateRepositoryInput{
+		RepositoryName:          aws.String(metadata.targetRepository()),
+		ImageTagMutability:      settings.tagMutability,
+		EncryptionConfiguration: e.targetEncryption(metadata.targetRepository(), settings.encryption),
+		Tags:                    settings.resourceTags,
+	}
+
+	if settings.scanOnPush {
+		input.ImageScanningConfiguration = &types.ImageScanningConfiguration{ScanOnPush: true}
+	}
+
+	return input
+}
+
+func (e *ECR) reconcileSettings(metadata repositoryMetadata) error {
+	repositoryName := metadata.targetRepository()
+	resp, err := e.ecr.DescribeRepositories(e.ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []string{repositoryName},
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Repositories) == 0 {
+		return fmt.Errorf("repository %s not found", repositoryName)
+	}
+
+	current := e.pullSettings(resp.Repositories[0])
+	source := metadata.settings
+
+	if source.tagMutability != "" && source.tagMutability != current.tagMutability {
+		if _, err := e.ecr.PutImageTagMutability(e.ctx, &ecr.PutImageTagMutabilityInput{
+			RepositoryName:     aws.String(repositoryName),
+			ImageTagMutability: source.tagMutability,
+		}); err != nil {
+			return err
+		}
+		slog.Info("reconcileSettings", "repository", repositoryName, "imageTagMutability", source.tagMutability, "status", "updated")
+	}
+
+	if source.scanOnPush != current.scanOnPush {
+		if _, err := e.ecr.PutImageScanningConfiguration(e.ctx, &ecr.PutImageScanningConfigurationInput{
+			RepositoryName:             aws.String(repositoryName),
+			ImageScanningConfiguration: &types.ImageScanningConfiguration{ScanOnPush: source.scanOnPush},
+		}); err != nil {
+			return err
+		}
+		slog.Info("reconcileSettings", "repository", repositoryName, "scanOnPush", source.scanOnPush, "status", "updated")
+	}
+
+	if missing := missingTags(source.resourceTags, current.resourceTags); len(missing) > 0 && current.arn != "" {
+		if _, err := e.ecr.TagResource(e.ctx, &ecr.TagResourceInput{
+			ResourceArn: aws.String(current.arn),
+			Tags:        missing,
+		}); err != nil {
+			return err
+		}
+		slog.Info("reconcileSettings", "repository", repositoryName, "tags", len(missing), "status", "updated")
+	}
+
+	want := e.targetEncryption(repositoryName, source.encryption)
+	if want != nil && current.encryption != nil && want.EncryptionType != current.encryption.EncryptionType {
+		slog.Warn("reconcileSettings", "repository", repositoryName, "encryptionType", current.encryption.EncryptionType, "expected", want.EncryptionType, "status", "encryption can only be set when the repository is created")
+	}
+
+	return nil
+}
+
+func missingTags(source, current []types.Tag) []types.Tag {
+	values := make(map[string]string, len(current))
+	for _, tag := range current {
+		values[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	var missing []types.Tag
+	for _, tag := range source {
+		if value, found := values[aws.ToString(tag.Key)]; !found || value != aws.ToString(tag.Value) {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositorySettings(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	for _, name := range []string{"repo/test/app1", "repo/test/app2"} {
+		sourceRegistry.addImage(name, []string{"1.0"}, []byte("layer"))
+		repo := sourceRegistry.repository(name)
+		repo.tagMutability = string(types.ImageTagMutabilityImmutable)
+		repo.scanOnPush = true
+		repo.encryptionType = string(types.EncryptionTypeKms)
+		repo.kmsKey = "arn:aws:kms:us-east-1:111111111111:key/source"
+		repo.resourceTags = map[string]string{"team": "platform"}
+	}
+
+	existing := targetRegistry.repository("repo/test/app2")
+	existing.tagMutability = string(types.ImageTagMutabilityMutable)
+	existing.encryptionType = string(types.EncryptionTypeAes256)
+
+	metadata := mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1", "repo/test/app2"})
+
+	target := targetRegistry.client().
+		withKmsKeys(map[string]string{"arn:aws:kms:us-east-1:111111111111:key/source": "arn:aws:kms:us-east-1:222222222222:key/target"}).
+		withReconcileSettings(true)
+	target.validate(metadata)
+
+	created := targetRegistry.repository("repo/test/app1")
+	assert.Equal(t, string(types.ImageTagMutabilityImmutable), created.tagMutability)
+	assert.True(t, created.scanOnPush)
+	assert.Equal(t, string(types.EncryptionTypeKms), created.encryptionType)
+	assert.Equal(t, "arn:aws:kms:us-east-1:222222222222:key/target", created.kmsKey, "expected the kms key to be mapped")
+	assert.Equal(t, map[string]string{"team": "platform"}, created.resourceTags)
+
+	assert.Equal(t, string(types.ImageTagMutabilityImmutable), existing.tagMutability, "expected existing repository to be reconciled")
+	assert.True(t, existing.scanOnPush)
+	assert.Equal(t, map[string]string{"team": "platform"}, existing.resourceTags)
+	assert.Equal(t, string(types.EncryptionTypeAes256), existing.encryptionType, "encryption can not change after creation")
+}
+
+func TestTargetEncryption(t *testing.T) {
+	target := newEcr(nil).withKmsKeys(map[string]string{"source": "target"})
+
+	assert.Nil(t, target.targetEncryption("repo", nil))
+
+	aes := &types.EncryptionConfiguration{EncryptionType: types.EncryptionTypeAes256}
+	assert.Equal(t, aes, target.targetEncryption("repo", aes))
+
+	mapped := target.targetEncryption("repo", &types.EncryptionConfiguration{EncryptionType: types.EncryptionTypeKms, KmsKey: aws.String("source")})
+	assert.Equal(t, "target", aws.ToString(mapped.KmsKey))
+
+	unmapped := target.targetEncryption("repo", &types.EncryptionConfiguration{EncryptionType: types.EncryptionTypeKms, KmsKey: aws.String("other")})
+	assert.Equal(t, types.EncryptionTypeKms, unmapped.EncryptionType)
+	assert.Nil(t, unmapped.KmsKey, "expected unmapped keys to fall back to the aws managed key")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultGracePeriod = 30 * time.Second
+
+type shutdown struct {
+	ctx      context.Context
+	draining context.Context
+	cancel   context.CancelFunc
+	drain    context.CancelFunc
+	signals  chan os.Signal
+	grace    time.Duration
+	done     chan struct{}
+}
+
+func newShutdown(grace time.Duration) *shutdown {
+	ctx, cancel := context.WithCancel(context.Background())
+	draining, drain := context.WithCancel(ctx)
+
+	return &shutdown{
+		ctx:      ctx,
+		draining: draining,
+		cancel:   cancel,
+		drain:    drain,
+		signals:  make(chan os.Signal, 2),
+		grace:    grace,
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *shutdown) listen() *shutdown {
+	signal.Notify(s.signals, os.Interrupt, syscall.SIGTERM)
+	go s.wait()
+	return s
+}
+
+func (s *shutdown) wait() {
+	select {
+	case sig := <-s.signals:
+		slog.Warn("shutdown", "signal", sig, "gracePeriod", s.grace, "status", "no new images will be started, waiting for in-flight transfers")
+		s.drain()
+	case <-s.done:
+		return
+	}
+
+	select {
+	case sig := <-s.signals:
+		slog.Warn("shutdown", "signal", sig, "status", "second signal, cancelling in-flight transfers")
+	case <-time.After(s.grace):
+		slog.Warn("shutdown", "gracePeriod", s.grace, "status", "grace period expired, cancelling in-flight transfers")
+	case <-s.done:
+		return
+	}
+	s.cancel()
+}
+
+func (s *shutdown) stopping() bool {
+	return s != nil && s.draining.Err() != nil
+}
+
+func (s *shutdown) err(err error) error {
+	if !s.stopping() {
+		return err
+	}
+	return &interruptedError{err: err}
+}
+
+func (s *shutdown) stop() {
+	signal.Stop(s.signals)
+	close(s.done)
+	s.cancel()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	s := newShutdown(50 * time.Millisecond)
+	go s.wait()
+	defer s.stop()
+
+	assert.False(t, s.stopping())
+	assert.NoError(t, s.err(nil))
+
+	s.signals <- os.Interrupt
+	assert.Eventually(t, s.stopping, time.Second, time.Millisecond)
+	assert.NoError(t, s.ctx.Err(), "expected in-flight work to keep its context during the grace period")
+
+	assert.Eventually(t, func() bool { return s.ctx.Err() != nil }, time.Second, time.Millisecond, "expected the grace period to cancel in-flight work")
+	assert.Equal(t, exitInterrupted, exitCode(s.err(nil)))
+}
+
+func TestShutdownSecondSignal(t *testing.T) {
+	s := newShutdown(time.Hour)
+	go s.wait()
+	defer s.stop()
+
+	s.signals <- os.Interrupt
+	s.signals <- syscall.SIGTERM
+	assert.Eventually(t, func() bool { return s.ctx.Err() != nil }, time.Second, time.Millisecond, "expected a second signal to cancel in-flight work")
+}
+
+func TestTransferShutdown(t *testing.T) {
+	sourceRegistry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer sourceRegistry.server.Close()
+
+	targetRegistry := newFakeEcr("222222222222.dkr.ecr.us-east-1.amazonaws.com")
+	defer targetRegistry.server.Close()
+
+	sourceRegistry.addImage("repo/test/app1", []string{"1.0"}, []byte("layer-1"))
+	sourceRegistry.addImage("repo/test/app1", []string{"2.0"}, []byte("layer-2"))
+
+	metadata := mustWalk(t, sourceRegistry.client(), []string{"repo/test/app1"})
+
+	s := newShutdown(time.Hour)
+	defer s.stop()
+	s.drain()
+
+	err := newTransfer().
+		withSource(sourceRegistry.client()).
+		withTarget(targetRegistry.client()).
+		withShutdown(s).
+		addMetadataList(metadata).
+		withArgs(&Args{engine: engineECR, copiers: 1}).
+		migrate()
+
+	assert.NoError(t, err, "expected images not started to be cancelled rather than failed")
+	assert.Equal(t, exitInterrupted, exitCode(s.err(err)))
+	assert.Nil(t, targetRegistry.image("repo/test/app1", "1.0"))
+	assert.Nil(t, targetRegistry.image("repo/test/app1", "2.0"))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const tokenRefreshWindow = 30 * time.Minute
+
+type tokenSource interface {
+	token() (authorization, error)
+	expire()
+}
+
+func (a authorization) token() (authorization, error) {
+	return a, nil
+}
+
+func (a authorization) expire() {}
+
+type tokenProvider struct {
+	mu       sync.Mutex
+	registry *ECR
+	current  authorization
+	window   time.Duration
+	now      func() time.Time
+}
+
+func newTokenProvider(registry *ECR) *tokenProvider {
+	return &tokenProvider{
+		registry: registry,
+		window:   tokenRefreshWindow,
+		now:      time.Now,
+	}
+}
+
+func (p *tokenProvider) withToken(auth authorization) *tokenProvider {
+	p.current = auth
+	return p
+}
+
+func (p *tokenProvider) valid() bool {
+	if p.current.username == "" {
+		return false
+	}
+	return p.current.expiresAt.IsZero() || p.now().Add(p.window).Before(p.current.expiresAt)
+}
+
+func (p *tokenProvider) token() (authorization, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.registry == nil || p.valid() {
+		return p.current, nil
+	}
+
+	auth, err := p.registry.authenticate()
+	if err != nil {
+		return authorization{}, authErr(err)
+	}
+
+	p.current = auth
+	slog.Info("tokenRefresh", "expiresAt", auth.expiresAt, "status", "refreshed")
+	return auth, nil
+}
+
+func (p *tokenProvider) expire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current.expiresAt = p.now()
+	slog.Warn("tokenRefresh", "status", "expired, requesting a new token on next use")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenProvider(t *testing.T) {
+	registry := newFakeEcr("111111111111.dkr.ecr.us-east-1.amazonaws.com")
+	defer registry.server.Close()
+
+	now := time.Now()
+	provider := newTokenProvider(registry.client()).withToken(authorization{username: "AWS", password: "old", expiresAt: now.Add(2 * time.Hour)})
+
+	auth, err := provider.token()
+	assert.NoError(t, err)
+	assert.Equal(t, "old", auth.password)
+	assert.Zero(t, registry.calls["GetAuthorizationToken"], "expected a valid token to be reused")
+
+	provider.now = func() time.Time { return now.Add(time.Hour + 45*time.Minute) }
+
+	auth, err = provider.token()
+	assert.NoError(t, err)
+	assert.Equal(t, registry.host, auth.password, "expected the token to be refreshed ahead of expiry")
+	assert.True(t, auth.expiresAt.After(now.Add(11*time.Hour)))
+	assert.Equal(t, 1, registry.calls["GetAuthorizationToken"])
+
+	_, err = provider.token()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, registry.calls["GetAuthorizationToken"], "expected the refreshed token to be reused")
+}
+
+func TestStaticTokenProvider(t *testing.T) {
+	expired := authorization{username: "AWS", password: "static", expiresAt: time.Now().Add(-time.Hour)}
+
+	auth, err := newTokenProvider(nil).withToken(expired).token()
+	assert.NoError(t, err)
+	assert.Equal(t, expired, auth, "expected a provider without registry to return its token as is")
+
+	auth, err = expired.token()
+	assert.NoError(t, err)
+	assert.Equal(t, expired, auth)
+}
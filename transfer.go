@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+type copier interface {
+	copy(image copyImage) (string, error)
+}
+
+type copyImage struct {
+	from           string
+	to             string
+	repositoryName string
+	reference      string
+	report         reportEntry
+}
+
+type Transfer struct {
+	ctx        context.Context
+	args       *Args
+	source     *ECR
+	target     *ECR
+	data       metadataList
+	copych     chan copyImage
+	done       chan struct{}
+	checkpoint *Checkpoint
+	retry      *retryPolicy
+	shutdown   *shutdown
+	report     *migrationReport
+	failures   failureList
+}
+
+func newTransfer() *Transfer {
+	return &Transfer{
+		ctx:   context.Background(),
+		done:  make(chan struct{}),
+		retry: newRetryPolicy(),
+	}
+}
+
+func (t *Transfer) withArgs(args *Args) *Transfer {
+	t.args = args
+	return t
+}
+
+func (t *Transfer) withSource(source *ECR) *Transfer {
+	t.source = source
+	return t
+}
+
+func (t *Transfer) withTarget(target *ECR) *Transfer {
+	t.target = target
+	return t
+}
+
+func (t *Transfer) withCheckpoint(checkpoint *Checkpoint) *Transfer {
+	t.checkpoint = checkpoint
+	return t
+}
+
+func (t *Transfer) withShutdown(shutdown *shutdown) *Transfer {
+	t.shutdown = shutdown
+	t.ctx = shutdown.ctx
+	return t
+}
+
+func (t *Transfer) withReport(report *migrationReport) *Transfer {
+	t.report = report
+	return t
+}
+
+func (t *Transfer) withRetry(retry *retryPolicy) *Transfer {
+	t.retry = retry
+	return t
+}
+
+func (t *Transfer) addMetadataList(metadataList metadataList) *Transfer {
+	t.data = metadataList
+	return t
+}
+
+func (t *Transfer) copier(target *ECR, authTarget authorization) copier {
+	if t.args.engine == engineECR {
+		return newEcrCopy(t.source, target).withPlatforms(t.args.platforms)
+	}
+	return newDistribution(
+		newTokenProvider(t.source).withToken(t.data.auth),
+		newTokenProvider(target).withToken(authTarget),
+	).withContext(t.ctx).withPlatforms(t.args.platforms)
+}
+
+func (t *Transfer) migrate() error {
+	authTarget, targetRepositoriesMetadata, failed, err := t.target.prepare(t.data)
+	if err != nil {
+		return err
+	}
+	engine := t.copier(t.target, authTarget)
+
+	t.copych = make(chan copyImage, t.data.imagesCount)
+	for _, metadata := range t.data.repoList {
+		references := slices.Concat(metadata.tags, metadata.digests)
+		if err, found := failed[metadata.repositoryName]; found {
+			t.failures.addRepository(metadata.repositoryName, references, err)
+			t.report.addFailed(metadata, references, err)
+			continue
+		}
+
+		for _, reference := range references {
+			from, to := generateECRImageNames(
+				targetRepositoriesMetadata,
+				metadata.targetRepository(),
+				metadata.repositoryURI,
+				reference,
+				metadata.targetReference(reference),
+			)
+			entry := newReportEntry(metadata, reference, from, to)
+
+			if t.checkpoint.completed(metadata.repositoryName, reference) {
+				slog.Info("imageCopying", "repositoryName", metadata.repositoryName, "reference", reference, "status", "already migrated")
+				t.report.add(entry.pushed(t.checkpoint.digest(metadata.repositoryName, reference)).with(outcomeMigrated))
+				continue
+			}
+			t.checkpoint.set(metadata.repositoryName, reference, stateDiscovered, nil)
+
+			t.copych <- copyImage{
+				from:           from,
+				to:             to,
+				repositoryName: metadata.repositoryName,
+				reference:      reference,
+				report:         entry,
+			}
+		}
+	}
+	close(t.copych)
+
+	for i := 0; i < t.args.copiers; i++ {
+		go func() {
+			t.copiers(engine)
+		}()
+	}
+
+	t.waitCopiers()
+	return t.failures.err()
+}
+
+func (t *Transfer) copiers(engine copier) {
+	defer func() {
+		t.done <- struct{}{}
+		slog.Info("copier", "status", "exited")
+	}()
+
+	for image := range t.copych {
+		if t.shutdown.stopping() {
+			t.failures.cancel(image.repositoryName, image.reference)
+			t.report.add(image.report.with(outcomeCancelled))
+			continue
+		}
+		t.failures.attempt()
+
+		var digest string
+		started := time.Now()
+		attempts, err := t.retry.run("imageCopying", func() error {
+			var err error
+			digest, err = engine.copy(image)
+			return err
+		})
+		t.report.add(image.report.finish(started, attempts, err).pushed(digest))
+		if err != nil {
+			slog.Error("imageCopying", "from", image.from, "to", image.to, "error", err)
+			t.checkpoint.set(image.repositoryName, image.reference, stateFailed, err)
+			t.failures.add(image.repositoryName, image.reference, err)
+			continue
+		}
+		t.checkpoint.pushed(image.repositoryName, image.reference, stateVerified, digest)
+
+		slog.Info("imageCopying", "from", image.from, "to", image.to, "status", "copied")
+	}
+}
+
+func (t *Transfer) waitCopiers() {
+	for i := 0; i < t.args.copiers; i++ {
+		<-t.done
+	}
+}